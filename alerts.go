@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	alertMinBackoff = time.Second
+	alertMaxBackoff = time.Minute * 5
+)
+
+var defaultAlertEvents = []string{"VMD", "linedetection", "fielddetection"}
+
+var alertDescriptions = map[string]string{
+	"VMD":            "Motion",
+	"linedetection":  "Line crossing",
+	"fielddetection": "Intrusion",
+}
+
+// AlertStreamDriver is implemented by drivers which can push camera side events
+type AlertStreamDriver interface {
+	AlertStreamURL() string
+}
+
+type isapiEventAlert struct {
+	ChannelID        string `xml:"channelID"`
+	DynChannelID     string `xml:"dynChannelID"`
+	EventType        string `xml:"eventType"`
+	EventState       string `xml:"eventState"`
+	EventDescription string `xml:"eventDescription"`
+}
+
+func (a isapiEventAlert) Channel() int {
+	channel := a.ChannelID
+	if channel == "" {
+		channel = a.DynChannelID
+	}
+
+	number, err := strconv.Atoi(channel)
+	if err != nil {
+		return 0
+	}
+
+	return number
+}
+
+// AlertStreams subscribes to ISAPI alert streams of cameras with enabled alerts.
+// Cameras sharing one device (NVR channels) share single subscription.
+type AlertStreams struct {
+	cameras *Cameras
+	notify  func(event CameraEvent)
+	// subscriptions maps alert stream URL to cameras listening on it
+	subscriptions map[string][]CameraConfig
+}
+
+func (as *AlertStreams) Setup(cameras *Cameras, configs []CameraConfig, notify func(event CameraEvent)) error {
+	as.cameras = cameras
+	as.notify = notify
+	as.subscriptions = make(map[string][]CameraConfig)
+
+	for _, conf := range configs {
+		if !conf.Alerts {
+			continue
+		}
+
+		driver, err := cameras.Driver(conf.Tag)
+		if err != nil {
+			return err
+		}
+
+		alertDriver, ok := driver.(AlertStreamDriver)
+		if !ok {
+			return fmt.Errorf("camera driver %q does not support alerts for camera with tag: %v", conf.Driver, conf.Tag)
+		}
+
+		url := alertDriver.AlertStreamURL()
+		as.subscriptions[url] = append(as.subscriptions[url], conf)
+	}
+
+	return nil
+}
+
+func (as *AlertStreams) Start() {
+	for url, confs := range as.subscriptions {
+		go as.watch(url, confs)
+	}
+}
+
+// watch keeps alert stream connected reconnecting with exponential backoff
+func (as *AlertStreams) watch(url string, confs []CameraConfig) {
+	client, err := as.cameras.StreamingClient(confs[0].Tag)
+	if err != nil {
+		log.Println("Failed to get alert stream client", url, err)
+		return
+	}
+
+	backoff := alertMinBackoff
+	for {
+		connectedAt := time.Now()
+		err := as.listen(client, url, confs)
+		log.Println("Alert stream disconnected", url, err)
+
+		if time.Since(connectedAt) > alertMaxBackoff {
+			backoff = alertMinBackoff
+		}
+
+		time.Sleep(backoff)
+		backoff = min(backoff*2, alertMaxBackoff)
+	}
+}
+
+func (as *AlertStreams) listen(client *http.Client, url string, confs []CameraConfig) error {
+	res, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected alert stream response status: %v", res.StatusCode)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		return fmt.Errorf("unexpected alert stream content type: %v", res.Header.Get("Content-Type"))
+	}
+
+	log.Println("Alert stream connected", url)
+
+	reader := multipart.NewReader(res.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return err
+		}
+
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return err
+		}
+
+		if !strings.Contains(part.Header.Get("Content-Type"), "xml") {
+			continue
+		}
+
+		alert := isapiEventAlert{}
+		err = xml.Unmarshal(data, &alert)
+		if err != nil {
+			log.Println("Failed to parse alert", url, err)
+			continue
+		}
+
+		as.dispatch(alert, confs)
+	}
+}
+
+func (as *AlertStreams) dispatch(alert isapiEventAlert, confs []CameraConfig) {
+	if alert.EventState != "active" {
+		return
+	}
+
+	for _, conf := range confs {
+		if channel := alert.Channel(); channel != 0 && channel != conf.ChannelNumber() {
+			continue
+		}
+
+		if !slices.Contains(conf.AlertEventTypes(), alert.EventType) {
+			continue
+		}
+
+		description, ok := alertDescriptions[alert.EventType]
+		if !ok {
+			description = alert.EventDescription
+		}
+
+		as.notify(CameraEvent{
+			Tag:         conf.Tag,
+			Type:        alert.EventType,
+			Description: description,
+			Time:        time.Now(),
+		})
+	}
+}
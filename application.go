@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"eugeny-dementev.github.io/cameras-bot/ntgcalls"
@@ -13,21 +15,25 @@ import (
 	tg "github.com/amarnathcjd/gogram/telegram"
 )
 
-type CallContext struct {
-	protocol *tg.PhoneCallProtocol
-	user     *tg.UserObj
-}
-
 type Application struct {
 	tgClient        *tg.Client
-	tgCallContext   *CallContext
-	tgInputCall     *tg.InputPhoneCall
 	ntgClient       *ntgcalls.Client
+	calls           CallManager
 	tgBot           *gotgbot.Bot
 	tgBotDispatcher *ext.Dispatcher
 	tgBotUpdater    *ext.Updater
+	store           Store
 	state           *State
+	permissions     Permissions
+	callbacks       Callbacks
+	limiter         Limiter
+	audit           Audit
 	cameras         Cameras
+	events          Events
+	alerts          AlertStreams
+	motion          MotionDetectors
+	buffers         Buffers
+	timelapses      Timelapses
 	config          Config
 	env             Env
 }
@@ -52,13 +58,62 @@ func (a *Application) Init() error {
 		return err
 	}
 
+	storePath, err := a.config.GetStorePath()
+	if err != nil {
+		return err
+	}
+
+	a.store, err = OpenBoltStore(storePath)
+	if err != nil {
+		return err
+	}
+
 	a.state = &State{}
-	a.state.Setup()
+	a.state.Setup(a.store)
+
+	a.permissions = Permissions{}
+	a.permissions.Setup(&a.config, a.store)
+
+	a.callbacks = Callbacks{}
+	a.callbacks.Setup(a.config.BotToken)
+
+	a.limiter = Limiter{}
+	a.limiter.Setup(&a.config.Limits, a.store)
+
+	a.audit = Audit{}
+	a.audit.Setup(a)
+
+	a.events = Events{}
+	a.events.Setup(a)
+
+	a.alerts = AlertStreams{}
+	err = a.alerts.Setup(&a.cameras, a.config.Cameras, a.events.Notify)
+	if err != nil {
+		return err
+	}
+
+	a.buffers = Buffers{}
+	err = a.buffers.Setup(&a.config, &a.cameras, a.env)
+	if err != nil {
+		return err
+	}
+
+	a.timelapses = Timelapses{}
+	err = a.timelapses.Setup(a)
+	if err != nil {
+		return err
+	}
+
+	a.motion = MotionDetectors{}
+	a.motion.Setup(&a.cameras, a.config.Cameras, a.events.Notify)
 
 	a.initTgBotDispather()
 
 	a.ntgClient = ntgcalls.NTgCalls()
 
+	a.calls = CallManager{}
+	a.calls.Setup(a)
+
 	return nil
 }
 
@@ -83,6 +138,14 @@ func (a *Application) Start() error {
 		},
 	})
 
+	a.buffers.Start()
+	a.alerts.Start()
+	a.motion.Start()
+	a.timelapses.Start()
+	a.permissions.StartGuestExpiry(a.notifyGuestExpired)
+	a.audit.Start()
+	a.calls.Start()
+
 	success, err := a.tgBot.SetChatMenuButton(&gotgbot.SetChatMenuButtonOpts{MenuButton: gotgbot.MenuButtonCommands{}})
 	if !success || err != nil {
 		log.Fatal("failed to set chat menu button", err)
@@ -93,31 +156,67 @@ func (a *Application) Start() error {
 	return nil
 }
 
+// notifyGuestExpired tells admin and the guest that guest access has ended
+func (a *Application) notifyGuestExpired(guest Guest) {
+	messages := map[int64]string{
+		a.config.AdminId: fmt.Sprintf("Guest access of @%v (id %v) to %v has expired", guest.Username, guest.UserId, guest.Tags),
+		guest.UserId:     fmt.Sprintf("Your guest access to cameras %v has expired", guest.Tags),
+	}
+
+	for chatId, text := range messages {
+		_, err := a.tgBot.SendMessage(chatId, text, &gotgbot.SendMessageOpts{})
+		if err != nil {
+			log.Println("Failed to notify about expired guest", chatId, err)
+		}
+	}
+}
+
 func (a *Application) Idle() {
 	a.tgClient.Idle()
 	a.tgBotUpdater.Idle()
 	a.ntgClient.Free()
+	a.store.Close()
 }
 
-func (app *Application) AddCommand(name string, handler func(context *HandlerContext) error) {
+// AddCommand registers command available to users with permissions satisfying requirement
+func (app *Application) AddCommand(name string, requirement Requirement, handler func(context *HandlerContext) error) {
 	app.tgBotDispatcher.AddHandler(handlers.NewCommand(name, func(bot *gotgbot.Bot, ctx *ext.Context) error {
 		log.Println("Command is run", name)
 
-		if ctx.EffectiveUser.Id != app.config.AdminId {
-			bot.SendMessage(
-				app.config.AdminId,
-				fmt.Sprintf("@%v run /%v command", ctx.EffectiveUser.Username, name),
-				&gotgbot.SendMessageOpts{},
-			)
-		}
+		started := time.Now()
+		action := fmt.Sprintf("/%v", name)
 
-		permissions := app.config.GetPermissionsFor(ctx.EffectiveUser.Id)
+		permissions := app.permissions.GetPermissionsFor(ctx.EffectiveUser.Id)
 		if permissions == nil {
-			return nil
+			app.auditHandler(ctx, AuditCommand, action, requirement, started, ErrNotAllowed)
+			_, err := ctx.EffectiveChat.SendMessage(bot, "You have no access yet, run /start to request it", &gotgbot.SendMessageOpts{})
+			return err
+		}
+
+		err := app.authorize(ctx.EffectiveUser.Id, permissions, requirement)
+		if err != nil {
+			log.Println("Command is denied", name, requirement, err)
+			app.auditHandler(ctx, AuditCommand, action, requirement, started, err)
+			_, err := ctx.EffectiveChat.SendMessage(bot, deniedMessage(fmt.Sprintf("You are not allowed to use /%v", name), permissions, err), &gotgbot.SendMessageOpts{})
+			return err
+		}
+
+		err = app.limit(ctx.EffectiveUser.Id, permissions, requirement)
+		if err != nil {
+			log.Println("Command is limited", name, err)
+			app.auditHandler(ctx, AuditCommand, action, requirement, started, err)
+			_, err := ctx.EffectiveChat.SendMessage(bot, err.Error(), &gotgbot.SendMessageOpts{})
+			return err
 		}
 
 		log.Println("Command is allowed", name)
-		err := handler(&HandlerContext{bot, ctx, app})
+		err = app.state.AddHistory(ctx.EffectiveUser.Id, action)
+		if err != nil {
+			log.Println("Failed to add history", err)
+		}
+
+		err = handler(&HandlerContext{bot, ctx, app})
+		app.auditHandler(ctx, AuditCommand, action, requirement, started, err)
 		if err != nil {
 			return err
 		}
@@ -126,25 +225,37 @@ func (app *Application) AddCommand(name string, handler func(context *HandlerCon
 	}))
 }
 
-func (app *Application) AddCallback(callback string, handler func(context *HandlerContext) error) {
-	app.tgBotDispatcher.AddHandler(handlers.NewCallback(callbackquery.Equal(callback), func(bot *gotgbot.Bot, ctx *ext.Context) error {
-		log.Println("Callback is run", callback)
+// AddPublicCommand registers command available to everyone including unknown users
+func (app *Application) AddPublicCommand(name string, handler func(context *HandlerContext) error) {
+	app.tgBotDispatcher.AddHandler(handlers.NewCommand(name, func(bot *gotgbot.Bot, ctx *ext.Context) error {
+		log.Println("Public command is run", name)
 
-		if ctx.EffectiveUser.Id != app.config.AdminId {
-			bot.SendMessage(
-				app.config.AdminId,
-				fmt.Sprintf("@%v run %v callback", ctx.EffectiveUser.Username, callback),
-				&gotgbot.SendMessageOpts{},
-			)
+		started := time.Now()
+		err := handler(&HandlerContext{bot, ctx, app})
+		app.auditHandler(ctx, AuditCommand, fmt.Sprintf("/%v", name), Requirement{}, started, err)
+		if err != nil {
+			return err
 		}
 
-		permissions := app.config.GetPermissionsFor(ctx.EffectiveUser.Id)
-		if permissions == nil {
+		return nil
+	}))
+}
+
+// AddAdminCommand registers command available only to admin
+func (app *Application) AddAdminCommand(name string, handler func(context *HandlerContext) error) {
+	app.tgBotDispatcher.AddHandler(handlers.NewCommand(name, func(bot *gotgbot.Bot, ctx *ext.Context) error {
+		log.Println("Admin command is run", name)
+
+		started := time.Now()
+		action := fmt.Sprintf("/%v", name)
+
+		if !app.IsAdmin(ctx.EffectiveUser.Id) {
+			app.auditHandler(ctx, AuditCommand, action, Requires(CapAdmin), started, ErrNotAllowed)
 			return nil
 		}
 
-		log.Println("Callback is allowed", callback)
 		err := handler(&HandlerContext{bot, ctx, app})
+		app.auditHandler(ctx, AuditCommand, action, Requires(CapAdmin), started, err)
 		if err != nil {
 			return err
 		}
@@ -153,128 +264,119 @@ func (app *Application) AddCallback(callback string, handler func(context *Handl
 	}))
 }
 
-func (a *Application) VideoCall(stream, username string) {
-	fmt.Println("Calls:", a.ntgClient.Calls())
-	videoInput := fmt.Sprintf("ffmpeg -i %s -loglevel panic -f rawvideo -r 24 -pix_fmt yuv420p -vf scale=1920:1080 pipe:1", stream)
+// auditHandler records command or callback run with outcome derived from err
+func (app *Application) auditHandler(ctx *ext.Context, kind, action string, requirement Requirement, started time.Time, err error) {
+	outcome, message := auditOutcome(err)
+
+	app.audit.Record(AuditEntry{
+		Time:     started,
+		UserId:   ctx.EffectiveUser.Id,
+		Username: ctx.EffectiveUser.Username,
+		Kind:     kind,
+		Action:   action,
+		Camera:   requirement.Tag,
+		Outcome:  outcome,
+		Duration: time.Since(started),
+		Error:    message,
+	})
+}
 
-	rawUser, _ := a.tgClient.ResolveUsername(username)
-	user := rawUser.(*tg.UserObj)
+// ResolveUser returns user id by numeric id or @username
+func (a *Application) ResolveUser(value string) (int64, error) {
+	userId, err := strconv.ParseInt(value, 10, 64)
+	if err == nil {
+		return userId, nil
+	}
 
-	dhConfigRaw, _ := a.tgClient.MessagesGetDhConfig(0, 256)
-	dhConfig := dhConfigRaw.(*tg.MessagesDhConfigObj)
+	rawUser, err := a.tgClient.ResolveUsername(strings.TrimPrefix(value, "@"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to resolve user %v: %w", value, err)
+	}
 
-	gDesc := ntgcalls.MediaDescription{
-		Video: &ntgcalls.VideoDescription{
-			InputMode: ntgcalls.InputModeShell,
-			Input:     videoInput,
-			Width:     1920,
-			Height:    1080,
-			Fps:       24,
-		},
+	user, ok := rawUser.(*tg.UserObj)
+	if !ok {
+		return 0, fmt.Errorf("%v is not a user", value)
 	}
 
-	gAHash, _ := a.ntgClient.CreateP2PCall(user.ID, ntgcalls.DhConfig{
-		G:      dhConfig.G,
-		P:      dhConfig.P,
-		Random: dhConfig.Random,
-	}, nil, gDesc)
-
-	protocolRaw := a.ntgClient.GetProtocol()
-	protocol := &tg.PhoneCallProtocol{
-		UdpP2P:          protocolRaw.UdpP2P,
-		UdpReflector:    protocolRaw.UdpReflector,
-		MinLayer:        protocolRaw.MinLayer,
-		MaxLayer:        protocolRaw.MaxLayer,
-		LibraryVersions: protocolRaw.Versions,
+	return user.ID, nil
+}
+
+// AddCallbackAction registers handler of callback action,
+// camera carried by the payload is checked against requirement before handler is run
+func (app *Application) AddCallbackAction(action string, requirement Requirement, handler CallbackHandler) {
+	app.callbacks.routes[action] = callbackRoute{requirement, handler}
+}
+
+// dispatchCallback is the single entry point of all signed callbacks
+func (app *Application) dispatchCallback(bot *gotgbot.Bot, ctx *ext.Context) error {
+	log.Println("Callback is run", ctx.CallbackQuery.Data)
+
+	started := time.Now()
+	userId := ctx.EffectiveUser.Id
+
+	payload, err := app.callbacks.Decode(ctx.CallbackQuery.Data)
+	route, ok := app.callbacks.routes[payload.Action]
+	if err != nil || !ok {
+		log.Println("Callback is rejected", ctx.CallbackQuery.Data, err)
+		app.auditHandler(ctx, AuditCallback, ctx.CallbackQuery.Data, Requirement{}, started, ErrNotAllowed)
+		_, err := ctx.CallbackQuery.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "This button is no longer valid", ShowAlert: true})
+		return err
 	}
 
-	a.tgCallContext = &CallContext{
-		protocol,
-		user,
+	action := strings.TrimSpace(fmt.Sprintf("%v %v", payload.Action, strings.Join(payload.Params, " ")))
+	requirement := route.requirement
+	if requirement.Tag == "" {
+		requirement.Tag = payload.Camera
 	}
 
-	_, err := a.tgClient.PhoneRequestCall(
-		&tg.PhoneRequestCallParams{
-			Protocol: protocol,
-			UserID:   &tg.InputUserObj{UserID: user.ID, AccessHash: user.AccessHash},
-			GAHash:   gAHash,
-			RandomID: int32(tg.GenRandInt()),
-		},
-	)
+	permissions := app.permissions.GetPermissionsFor(userId)
+	if permissions == nil && userId != app.config.AdminId {
+		app.auditHandler(ctx, AuditCallback, action, requirement, started, ErrNotAllowed)
+		return nil
+	}
+
+	err = app.authorize(userId, permissions, requirement)
 	if err != nil {
-		a.tgCallContext = nil
-		fmt.Println(fmt.Errorf("error while making call: %v", err))
+		log.Println("Callback is denied", action, requirement, err)
+		app.auditHandler(ctx, AuditCallback, action, requirement, started, err)
+		_, err := ctx.CallbackQuery.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{
+			Text:      deniedMessage("You are not allowed to do this", permissions, err),
+			ShowAlert: true,
+		})
+		return err
 	}
 
-	fmt.Println("Calls:", a.ntgClient.Calls())
+	err = app.limit(userId, permissions, requirement)
+	if err != nil {
+		log.Println("Callback is limited", action, err)
+		app.auditHandler(ctx, AuditCallback, action, requirement, started, err)
+		_, err := ctx.CallbackQuery.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: err.Error(), ShowAlert: true})
+		return err
+	}
+
+	log.Println("Callback is allowed", action)
+	err = route.handler(&HandlerContext{bot, ctx, app}, payload)
+	app.auditHandler(ctx, AuditCallback, action, requirement, started, err)
+	if err != nil {
+		return err
+	}
+
+	return nil
 }
 
-func (a *Application) initCallHandlers() {
-	a.tgClient.AddRawHandler(&tg.UpdatePhoneCall{}, func(m tg.Update, c *tg.Client) error {
-		phoneCall := m.(*tg.UpdatePhoneCall).PhoneCall
-		switch phoneCall.(type) {
-		case *tg.PhoneCallAccepted:
-			call := phoneCall.(*tg.PhoneCallAccepted)
-			res, _ := a.ntgClient.ExchangeKeys(a.tgCallContext.user.ID, call.GB, 0)
-			a.tgInputCall = &tg.InputPhoneCall{
-				ID:         call.ID,
-				AccessHash: call.AccessHash,
-			}
-			a.ntgClient.OnSignal(func(chatId int64, signal []byte) {
-				_, _ = a.tgClient.PhoneSendSignalingData(a.tgInputCall, signal)
-			})
-			callConfirmRes, _ := a.tgClient.PhoneConfirmCall(
-				a.tgInputCall,
-				res.GAOrB,
-				res.KeyFingerprint,
-				a.tgCallContext.protocol,
-			)
-			callRes := callConfirmRes.PhoneCall.(*tg.PhoneCallObj)
-			rtcServers := make([]ntgcalls.RTCServer, len(callRes.Connections))
-			for i, connection := range callRes.Connections {
-				switch connection := connection.(type) {
-				case *tg.PhoneConnectionWebrtc:
-					rtcServer := connection
-					rtcServers[i] = ntgcalls.RTCServer{
-						ID:       rtcServer.ID,
-						Ipv4:     rtcServer.Ip,
-						Ipv6:     rtcServer.Ipv6,
-						Username: rtcServer.Username,
-						Password: rtcServer.Password,
-						Port:     rtcServer.Port,
-						Turn:     rtcServer.Turn,
-						Stun:     rtcServer.Stun,
-					}
-				case *tg.PhoneConnectionObj:
-					phoneServer := connection
-					rtcServers[i] = ntgcalls.RTCServer{
-						ID:      phoneServer.ID,
-						Ipv4:    phoneServer.Ip,
-						Ipv6:    phoneServer.Ipv6,
-						Port:    phoneServer.Port,
-						Turn:    true,
-						Tcp:     phoneServer.Tcp,
-						PeerTag: phoneServer.PeerTag,
-					}
-				}
-			}
-			_ = a.ntgClient.ConnectP2P(a.tgCallContext.user.ID, rtcServers, callRes.Protocol.LibraryVersions, callRes.P2PAllowed)
-		case *tg.PhoneCallDiscarded:
-			call := phoneCall.(*tg.PhoneCallDiscarded)
-			fmt.Println("PhoneCallDiscarded reason", call.Reason)
-			a.tgInputCall = nil
-			a.tgCallContext = nil
-		default:
-			panic(fmt.Sprintf("unexpected telegram.PhoneCall: %#v", phoneCall))
-		}
-		return nil
-	})
+// VideoCall calls the user streaming camera
+func (a *Application) VideoCall(tag, username string) error {
+	rawUser, err := a.tgClient.ResolveUsername(username)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %v: %w", username, err)
+	}
 
-	a.tgClient.AddRawHandler(&tg.UpdatePhoneCallSignalingData{}, func(m tg.Update, c *tg.Client) error {
-		signalingData := m.(*tg.UpdatePhoneCallSignalingData).Data
-		_ = a.ntgClient.SendSignalingData(a.tgCallContext.user.ID, signalingData)
-		return nil
-	})
+	user, ok := rawUser.(*tg.UserObj)
+	if !ok {
+		return fmt.Errorf("%v is not a user", username)
+	}
+
+	return a.calls.Dial(user, tag)
 }
 
 func (a *Application) initTgClient() error {
@@ -291,10 +393,6 @@ func (a *Application) initTgClient() error {
 
 	a.tgClient = mtproto
 
-	a.tgCallContext = nil
-
-	a.initCallHandlers()
-
 	return nil
 }
 
@@ -323,5 +421,7 @@ func (a *Application) initTgBotDispather() {
 		MaxRoutines: ext.DefaultMaxRoutines,
 	})
 
+	a.tgBotDispatcher.AddHandler(handlers.NewCallback(callbackquery.Prefix(callbackVersion+callbackSeparator), a.dispatchCallback))
+
 	a.tgBotUpdater = ext.NewUpdater(a.tgBotDispatcher, nil)
 }
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+const (
+	AuditCommand   = "command"
+	AuditCallback  = "callback"
+	AuditSnapshot  = "snapshot"
+	AuditRecording = "recording"
+	AuditCall      = "call"
+
+	AuditOk      = "ok"
+	AuditDenied  = "denied"
+	AuditLimited = "limited"
+	AuditError   = "error"
+
+	// AuditPings* control how admin is told about actions of other users
+	AuditPingsEach   = "each"
+	AuditPingsDigest = "digest"
+	AuditPingsOff    = "off"
+
+	defaultAuditDigestInterval = 60
+	defaultAuditRetentionDays  = 90
+
+	auditPruneInterval = time.Hour
+)
+
+type AuditEntry struct {
+	Time     time.Time     `json:"time"`
+	UserId   int64         `json:"user_id"`
+	Username string        `json:"username"`
+	Kind     string        `json:"kind"`
+	Action   string        `json:"action"`
+	Camera   string        `json:"camera,omitempty"`
+	Outcome  string        `json:"outcome"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+func (e AuditEntry) String() string {
+	line := fmt.Sprintf("%v @%v %v %v", e.Time.Format(time.DateTime), e.Username, e.Kind, e.Action)
+	if e.Camera != "" {
+		line += " " + e.Camera
+	}
+
+	return fmt.Sprintf("%v: %v (%v)", line, e.Outcome, e.Duration.Round(time.Millisecond))
+}
+
+// Audit is append-only log of camera access, entries are never modified and are pruned after configured retention
+type Audit struct {
+	app *Application
+	seq atomic.Uint64
+
+	mu      sync.Mutex
+	pending []AuditEntry
+}
+
+func (a *Audit) Setup(app *Application) {
+	a.app = app
+}
+
+func (a *Audit) Start() {
+	if a.app.config.AuditPingsMode() == AuditPingsDigest {
+		go a.digest()
+	}
+
+	go a.prune()
+}
+
+// auditKey orders entries by time, keys of entries recorded at the moment start with auditKey(moment)
+func auditKey(moment time.Time) string {
+	if moment.IsZero() {
+		return ""
+	}
+
+	return fmt.Sprintf("%020d", moment.UnixNano())
+}
+
+// Record appends entry to the log and pings admin according to config
+func (a *Audit) Record(entry AuditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	// sequence keeps keys unique for entries recorded within the same nanosecond
+	key := fmt.Sprintf("%v/%06d", auditKey(entry.Time), a.seq.Add(1)%1_000_000)
+	err := a.app.store.Put(bucketAudit, key, entry, 0)
+	if err != nil {
+		log.Println("Failed to record audit entry", entry, err)
+	}
+
+	if entry.UserId == a.app.config.AdminId {
+		return
+	}
+
+	switch a.app.config.AuditPingsMode() {
+	case AuditPingsEach:
+		if entry.Kind == AuditCommand || entry.Kind == AuditCallback {
+			a.ping(fmt.Sprintf("@%v run %v %v: %v", entry.Username, entry.Kind, entry.Action, entry.Outcome))
+		}
+	case AuditPingsDigest:
+		a.mu.Lock()
+		a.pending = append(a.pending, entry)
+		a.mu.Unlock()
+	}
+}
+
+// Query returns entries since the moment in chronological order, of all users when userId is 0
+func (a *Audit) Query(userId int64, since time.Time) []AuditEntry {
+	entries := make([]AuditEntry, 0)
+
+	err := a.app.store.ScanFrom(bucketAudit, auditKey(since), func(key string, raw json.RawMessage) bool {
+		entry := AuditEntry{}
+		if json.Unmarshal(raw, &entry) != nil {
+			return true
+		}
+
+		if userId != 0 && entry.UserId != userId {
+			return true
+		}
+
+		entries = append(entries, entry)
+
+		return true
+	})
+	if err != nil {
+		log.Println("Failed to scan audit log", err)
+	}
+
+	return entries
+}
+
+// prune removes entries older than configured retention
+func (a *Audit) prune() {
+	ticker := time.NewTicker(auditPruneInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		pruned, err := a.app.store.Prune(bucketAudit, auditKey(now.Add(-a.app.config.AuditRetention())))
+		if err != nil {
+			log.Println("Failed to prune audit log", err)
+			continue
+		}
+
+		if pruned > 0 {
+			log.Println("Audit entries pruned", pruned)
+		}
+	}
+}
+
+func (a *Audit) ping(text string) {
+	_, err := a.app.tgBot.SendMessage(a.app.config.AdminId, text, &gotgbot.SendMessageOpts{DisableNotification: true})
+	if err != nil {
+		log.Println("Failed to send audit ping", err)
+	}
+}
+
+// digest periodically sends admin a summary of actions instead of message per action
+func (a *Audit) digest() {
+	ticker := time.NewTicker(a.app.config.AuditDigestDuration())
+	defer ticker.Stop()
+
+	for range ticker.C {
+		a.mu.Lock()
+		pending := a.pending
+		a.pending = nil
+		a.mu.Unlock()
+
+		if len(pending) == 0 {
+			continue
+		}
+
+		counts := make(map[string]int)
+		for _, entry := range pending {
+			counts[fmt.Sprintf("@%v %v %v %v", entry.Username, entry.Kind, entry.Camera, entry.Outcome)]++
+		}
+
+		lines := make([]string, 0, len(counts))
+		for line, count := range counts {
+			lines = append(lines, fmt.Sprintf("%v x%v", strings.Join(strings.Fields(line), " "), count))
+		}
+		slices.Sort(lines)
+
+		a.ping(fmt.Sprintf("Activity digest, %v actions:\n%v", len(pending), strings.Join(lines, "\n")))
+	}
+}
+
+func AuditCSV(entries []AuditEntry) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	writer := csv.NewWriter(&buffer)
+
+	err := writer.Write([]string{"time", "user_id", "username", "kind", "action", "camera", "outcome", "duration_ms", "error"})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		err := writer.Write([]string{
+			entry.Time.Format(time.RFC3339),
+			strconv.FormatInt(entry.UserId, 10),
+			entry.Username,
+			entry.Kind,
+			entry.Action,
+			entry.Camera,
+			entry.Outcome,
+			strconv.FormatInt(entry.Duration.Milliseconds(), 10),
+			entry.Error,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	writer.Flush()
+
+	return buffer.Bytes(), writer.Error()
+}
+
+func auditOutcome(err error) (string, string) {
+	if limitErr := (*LimitError)(nil); errors.As(err, &limitErr) {
+		return AuditLimited, err.Error()
+	}
+
+	if errors.Is(err, ErrNotAllowed) || errors.Is(err, ErrOutsideSchedule) {
+		return AuditDenied, err.Error()
+	}
+
+	if err != nil {
+		return AuditError, err.Error()
+	}
+
+	return AuditOk, ""
+}
+
+// auditAccess records camera access of the handler user, err points to handler result
+func (c *HandlerContext) auditAccess(kind, tag string, started time.Time, err *error) {
+	outcome, message := auditOutcome(*err)
+
+	c.app.audit.Record(AuditEntry{
+		Time:     started,
+		UserId:   c.ctx.EffectiveUser.Id,
+		Username: c.ctx.EffectiveUser.Username,
+		Kind:     kind,
+		Action:   kind,
+		Camera:   tag,
+		Outcome:  outcome,
+		Duration: time.Since(started),
+		Error:    message,
+	})
+}
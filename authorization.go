@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Authorization layer shared by handler middleware and handlers:
+// middleware rejects requests for cameras user has no capability on
+// and handlers build menus only from cameras returned by CamerasFor.
+
+// IsAdmin reports whether user is admin from config or has admin role
+func (app *Application) IsAdmin(userId int64) bool {
+	if userId == app.config.AdminId {
+		return true
+	}
+
+	permissions := app.permissions.GetPermissionsFor(userId)
+
+	return permissions != nil && permissions.IsAdmin()
+}
+
+// CanAccess reports whether user may perform capability on camera with the tag right now
+func (app *Application) CanAccess(userId int64, tag string, capability Capability) bool {
+	if userId == app.config.AdminId {
+		return slices.ContainsFunc(app.config.Cameras, func(camera CameraConfig) bool {
+			return camera.Tag == tag
+		})
+	}
+
+	permissions := app.permissions.GetPermissionsFor(userId)
+
+	return permissions != nil && permissions.Can(tag, capability)
+}
+
+// CamerasFor returns cameras on which user may perform capability right now, in config order
+func (app *Application) CamerasFor(userId int64, capability Capability) []CameraConfig {
+	cameras := make([]CameraConfig, 0)
+	for _, camera := range app.config.Cameras {
+		if app.CanAccess(userId, camera.Tag, capability) {
+			cameras = append(cameras, camera)
+		}
+	}
+
+	return cameras
+}
+
+// TagsFor returns tags of cameras on which user may perform capability right now
+func (app *Application) TagsFor(userId int64, capability Capability) []string {
+	tags := make([]string, 0)
+	for _, camera := range app.CamerasFor(userId, capability) {
+		tags = append(tags, camera.Tag)
+	}
+
+	return tags
+}
+
+// authorize checks requirement against user permissions, admin from config is allowed everything
+func (app *Application) authorize(userId int64, permissions *CameraPermissions, requirement Requirement) error {
+	if userId == app.config.AdminId {
+		return nil
+	}
+
+	return requirement.Check(permissions, time.Now())
+}
+
+func deniedMessage(notAllowed string, permissions *CameraPermissions, err error) string {
+	if errors.Is(err, ErrOutsideSchedule) {
+		return fmt.Sprintf("Access outside of allowed hours\nAllowed: %v", permissions.Schedule)
+	}
+
+	return notAllowed
+}
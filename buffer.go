@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	segmentDuration   = time.Second * 10
+	segmentTimeFormat = "20060102150405"
+	segmentExt        = ".ts"
+)
+
+type segment struct {
+	path  string
+	start time.Time
+	end   time.Time
+}
+
+// SegmentBuffer keeps last minutes of camera stream on disk as short MPEG-TS segments
+type SegmentBuffer struct {
+	env     Env
+	tag     string
+	cameras *Cameras
+	dir     string
+	keep    time.Duration
+}
+
+func (sb *SegmentBuffer) Start() {
+	go sb.record()
+	go sb.cleanup()
+}
+
+// record runs ffmpeg segment muxer restarting it with backoff when stream breaks,
+// stream URL is looked up on every start since cameras may be resolved after boot
+func (sb *SegmentBuffer) record() {
+	backoff := alertMinBackoff
+	for {
+		startedAt := time.Now()
+
+		err := sb.run()
+		log.Println("Segment recorder stopped", sb.tag, err)
+
+		if time.Since(startedAt) > alertMaxBackoff {
+			backoff = alertMinBackoff
+		}
+
+		time.Sleep(backoff)
+		backoff = min(backoff*2, alertMaxBackoff)
+	}
+}
+
+// run records segments from current stream URL until ffmpeg exits
+func (sb *SegmentBuffer) run() error {
+	input, err := sb.cameras.Stream(sb.tag, StreamMain)
+	if err != nil {
+		return err
+	}
+	if input == "" {
+		return fmt.Errorf("no stream url for %v camera", sb.tag)
+	}
+
+	// @EXAMPLE: ffmpeg -i "rtsp://..." -map 0:v -c copy -f segment -segment_time 10 -strftime 1 "./%Y%m%d%H%M%S.ts"
+	cmd := exec.Command("ffmpeg", "-loglevel", "error")
+	if sb.env.isDocker {
+		cmd.Args = append(cmd.Args,
+			"-rtsp_transport", "tcp",
+		)
+	}
+	cmd.Args = append(
+		cmd.Args,
+		"-i", input,
+		"-map", "0:v",
+		"-c", "copy",
+		"-f", "segment",
+		"-segment_time", fmt.Sprintf("%v", segmentDuration.Seconds()),
+		"-segment_format", "mpegts",
+		"-reset_timestamps", "1",
+		"-strftime", "1",
+		path.Join(sb.dir, "%Y%m%d%H%M%S"+segmentExt),
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w: %v", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// cleanup removes segments which are out of the buffer window
+func (sb *SegmentBuffer) cleanup() {
+	ticker := time.NewTicker(segmentDuration)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		segments, err := sb.segments()
+		if err != nil {
+			log.Println("Failed to list segments", sb.tag, err)
+			continue
+		}
+
+		deadline := time.Now().Add(-sb.keep)
+		for _, segment := range segments {
+			if segment.end.Before(deadline) {
+				os.Remove(segment.path)
+			}
+		}
+	}
+}
+
+// segments returns buffered segments sorted by start time, the last one may still be recorded
+func (sb *SegmentBuffer) segments() ([]segment, error) {
+	entries, err := os.ReadDir(sb.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]segment, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != segmentExt {
+			continue
+		}
+
+		start, err := time.ParseInLocation(segmentTimeFormat, strings.TrimSuffix(name, segmentExt), time.Local)
+		if err != nil {
+			continue
+		}
+
+		segments = append(segments, segment{
+			path:  path.Join(sb.dir, name),
+			start: start,
+		})
+	}
+
+	slices.SortFunc(segments, func(a, b segment) int {
+		return a.start.Compare(b.start)
+	})
+
+	for i := range segments {
+		if i+1 < len(segments) {
+			segments[i].end = segments[i+1].start
+		} else {
+			segments[i].end = time.Now()
+		}
+	}
+
+	return segments, nil
+}
+
+// WaitUntil blocks until segment containing moment is finished or recorder looks stuck
+func (sb *SegmentBuffer) WaitUntil(moment time.Time) {
+	time.Sleep(time.Until(moment))
+
+	deadline := moment.Add(segmentDuration * 2)
+	for time.Now().Before(deadline) {
+		segments, err := sb.segments()
+		if err == nil && len(segments) > 0 && !segments[len(segments)-1].start.Before(moment) {
+			return
+		}
+
+		time.Sleep(time.Second)
+	}
+}
+
+// Clip concatenates buffered segments covering [from, to) into single MP4 file
+func (sb *SegmentBuffer) Clip(from, to time.Time, filePath string) error {
+	segments, err := sb.segments()
+	if err != nil {
+		return err
+	}
+
+	selected := make([]segment, 0)
+	for _, segment := range segments {
+		if segment.start.Before(to) && segment.end.After(from) {
+			selected = append(selected, segment)
+		}
+	}
+
+	if len(selected) == 0 {
+		return fmt.Errorf("no buffered video for %v camera", sb.tag)
+	}
+
+	listPath := filePath + ".txt"
+	list := strings.Builder{}
+	for _, segment := range selected {
+		list.WriteString(fmt.Sprintf("file '%v'\n", segment.path))
+	}
+
+	err = os.WriteFile(listPath, []byte(list.String()), 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write segments list: %w", err)
+	}
+	defer os.Remove(listPath)
+
+	start := from
+	if selected[0].start.After(from) {
+		start = selected[0].start
+	}
+
+	offset := start.Sub(selected[0].start)
+	duration := to.Sub(start)
+
+	// @EXAMPLE: ffmpeg -ss 4 -f concat -safe 0 -i list.txt -t 30 -c copy clip.mp4
+	cmd := exec.Command(
+		"ffmpeg",
+		"-y",
+		"-loglevel", "error",
+		"-ss", fmt.Sprintf("%.3f", offset.Seconds()),
+		"-f", "concat",
+		"-safe", "0",
+		"-i", listPath,
+		"-t", fmt.Sprintf("%.3f", duration.Seconds()),
+		"-c", "copy",
+		"-movflags", "+faststart",
+		filePath,
+	)
+
+	fmt.Println("Prepared command", cmd)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to concat segments: %w: %v", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// Buffers holds segment buffers of cameras with enabled buffering
+type Buffers struct {
+	buffers map[string]*SegmentBuffer
+}
+
+func (bs *Buffers) Setup(config *Config, cameras *Cameras, env Env) error {
+	bs.buffers = make(map[string]*SegmentBuffer)
+
+	for _, conf := range config.Cameras {
+		if conf.Buffer == 0 {
+			continue
+		}
+
+		dir, err := config.GetBufferPath(conf.Tag)
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(dir, 0o755)
+		if err != nil {
+			return fmt.Errorf("failed to create buffer dir for camera with tag %v: %w", conf.Tag, err)
+		}
+
+		bs.buffers[conf.Tag] = &SegmentBuffer{
+			env:     env,
+			tag:     conf.Tag,
+			cameras: cameras,
+			dir:     dir,
+			keep:    time.Duration(conf.Buffer) * time.Minute,
+		}
+	}
+
+	return nil
+}
+
+func (bs *Buffers) Start() {
+	for _, buffer := range bs.buffers {
+		buffer.Start()
+	}
+}
+
+func (bs *Buffers) Get(tag string) (*SegmentBuffer, bool) {
+	buffer, ok := bs.buffers[tag]
+	return buffer, ok
+}
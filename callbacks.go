@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+const (
+	callbackVersion        = "1"
+	callbackSeparator      = "|"
+	callbackParamSeparator = ","
+	// callbackSignatureSize is amount of HMAC bytes kept in data, Telegram limits callback data to 64 bytes
+	callbackSignatureSize = 8
+	callbackDataLimit     = 64
+)
+
+var ErrInvalidCallback = errors.New("invalid callback data")
+
+// CallbackPayload is decoded callback data, camera and params are carried
+// in the button itself so no selection has to be kept between steps
+type CallbackPayload struct {
+	Action string
+	Camera string
+	Params []string
+}
+
+func NewCallback(action, camera string, params ...string) CallbackPayload {
+	return CallbackPayload{action, camera, params}
+}
+
+// Param returns parameter by index or empty string when it is missing
+func (p CallbackPayload) Param(index int) string {
+	if index >= len(p.Params) {
+		return ""
+	}
+
+	return p.Params[index]
+}
+
+type CallbackHandler func(c *HandlerContext, payload CallbackPayload) error
+
+type callbackRoute struct {
+	requirement Requirement
+	handler     CallbackHandler
+}
+
+// Callbacks signs callback data and routes pressed buttons to handlers by action.
+// Data format is version|action|camera|param,param|signature, tags and params must not contain separators.
+type Callbacks struct {
+	secret []byte
+	routes map[string]callbackRoute
+}
+
+func (cb *Callbacks) Setup(botToken string) {
+	mac := hmac.New(sha256.New, []byte(botToken))
+	mac.Write([]byte("callbacks"))
+
+	cb.secret = mac.Sum(nil)
+	cb.routes = make(map[string]callbackRoute)
+}
+
+// Encode signs payload, tags and params must not contain separators and data must fit Telegram limit
+func (cb *Callbacks) Encode(payload CallbackPayload) (string, error) {
+	fields := append([]string{payload.Action, payload.Camera}, payload.Params...)
+	for _, field := range fields {
+		if strings.Contains(field, callbackSeparator) || strings.Contains(field, callbackParamSeparator) {
+			return "", fmt.Errorf("callback field %q contains separator", field)
+		}
+	}
+
+	body := strings.Join([]string{
+		callbackVersion,
+		payload.Action,
+		payload.Camera,
+		strings.Join(payload.Params, callbackParamSeparator),
+	}, callbackSeparator)
+
+	data := body + callbackSeparator + cb.sign(body)
+	if len(data) > callbackDataLimit {
+		return "", fmt.Errorf("callback data %q exceeds %v bytes", body, callbackDataLimit)
+	}
+
+	return data, nil
+}
+
+// validateCallbackTag checks that camera tag can be carried by every callback,
+// signature length does not depend on secret so the longest payloads are encoded unsigned
+func validateCallbackTag(tag string) error {
+	longest := []CallbackPayload{
+		NewCallback(actionAccessTag, tag, strconv.FormatInt(math.MaxInt64, 10)),
+		NewCallback(actionPlaybackMinute, tag, "20060102", "15", "04"),
+	}
+
+	for _, payload := range longest {
+		_, err := (&Callbacks{}).Encode(payload)
+		if err != nil {
+			return fmt.Errorf("camera tag %q does not fit callback data: %w", tag, err)
+		}
+	}
+
+	return nil
+}
+
+func (cb *Callbacks) Decode(data string) (CallbackPayload, error) {
+	fields := strings.Split(data, callbackSeparator)
+	if len(fields) != 5 || fields[0] != callbackVersion {
+		return CallbackPayload{}, ErrInvalidCallback
+	}
+
+	body := strings.Join(fields[:4], callbackSeparator)
+	if !hmac.Equal([]byte(fields[4]), []byte(cb.sign(body))) {
+		return CallbackPayload{}, ErrInvalidCallback
+	}
+
+	params := []string{}
+	if fields[3] != "" {
+		params = strings.Split(fields[3], callbackParamSeparator)
+	}
+
+	return CallbackPayload{fields[1], fields[2], params}, nil
+}
+
+// Buttons builds callback buttons of one message keeping the first encoding error,
+// message must not be sent when Err is not nil since Telegram rejects it as a whole
+type Buttons struct {
+	callbacks *Callbacks
+	err       error
+}
+
+func (cb *Callbacks) Buttons() *Buttons {
+	return &Buttons{callbacks: cb}
+}
+
+func (b *Buttons) Button(text string, payload CallbackPayload) gotgbot.InlineKeyboardButton {
+	data, err := b.callbacks.Encode(payload)
+	if err != nil && b.err == nil {
+		b.err = err
+	}
+
+	return gotgbot.InlineKeyboardButton{
+		Text:         text,
+		CallbackData: data,
+	}
+}
+
+func (b *Buttons) Err() error {
+	return b.err
+}
+
+func (cb *Callbacks) sign(body string) string {
+	mac := hmac.New(sha256.New, cb.secret)
+	mac.Write([]byte(body))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:callbackSignatureSize])
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestCallbacks() *Callbacks {
+	cb := &Callbacks{}
+	cb.Setup("123456:test-token")
+
+	return cb
+}
+
+func TestCallbacksRoundTrip(t *testing.T) {
+	cb := newTestCallbacks()
+
+	payloads := []CallbackPayload{
+		NewCallback(actionPlaybackMinute, "yard", "20240607", "12", "30"),
+		NewCallback(actionRecordCamera, "yard"),
+		NewCallback(actionCallHangup, ""),
+	}
+
+	for _, payload := range payloads {
+		data, err := cb.Encode(payload)
+		if err != nil {
+			t.Fatalf("Encode(%v): %v", payload, err)
+		}
+
+		decoded, err := cb.Decode(data)
+		if err != nil {
+			t.Fatalf("Decode(%q): %v", data, err)
+		}
+
+		if decoded.Action != payload.Action || decoded.Camera != payload.Camera || strings.Join(decoded.Params, ",") != strings.Join(payload.Params, ",") {
+			t.Errorf("Decode(%q) = %v, want %v", data, decoded, payload)
+		}
+	}
+}
+
+func TestCallbacksTamper(t *testing.T) {
+	cb := newTestCallbacks()
+
+	data, err := cb.Encode(NewCallback(actionRecordCamera, "yard"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := []string{
+		strings.Replace(data, "yard", "door", 1),
+		data[:len(data)-1] + "A",
+		data + "|extra",
+	}
+
+	for _, data := range tampered {
+		_, err := cb.Decode(data)
+		if !errors.Is(err, ErrInvalidCallback) {
+			t.Errorf("Decode(%q) error = %v, want invalid callback", data, err)
+		}
+	}
+
+	other := &Callbacks{}
+	other.Setup("654321:other-token")
+	if _, err := other.Decode(data); !errors.Is(err, ErrInvalidCallback) {
+		t.Errorf("Decode with other secret error = %v, want invalid callback", err)
+	}
+}
+
+func TestCallbacksEncodeErrors(t *testing.T) {
+	cb := newTestCallbacks()
+
+	payloads := []CallbackPayload{
+		NewCallback(actionRecordCamera, "ya|rd"),
+		NewCallback(actionRecordCamera, "ya,rd"),
+		NewCallback(actionRecordStream, "yard", "ma,in"),
+		NewCallback(actionRecordCamera, strings.Repeat("y", 64)),
+	}
+
+	for _, payload := range payloads {
+		if _, err := cb.Encode(payload); err == nil {
+			t.Errorf("Encode(%v) succeeded", payload)
+		}
+	}
+}
+
+func TestValidateCallbackTag(t *testing.T) {
+	tests := []struct {
+		tag   string
+		valid bool
+	}{
+		{"yard", true},
+		{strings.Repeat("y", 27), true},
+		{strings.Repeat("y", 28), false},
+		{"front|door", false},
+		{"front,door", false},
+	}
+
+	for _, tt := range tests {
+		if err := validateCallbackTag(tt.tag); (err == nil) != tt.valid {
+			t.Errorf("validateCallbackTag(%q) = %v, want valid %v", tt.tag, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,770 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"eugeny-dementev.github.io/cameras-bot/ntgcalls"
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	tg "github.com/amarnathcjd/gogram/telegram"
+)
+
+const (
+	callWatchInterval = time.Second * 10
+
+	callAudioSampleRate = 48000
+	callAudioChannels   = 2
+
+	defaultCallMaxMinutes  = 30
+	defaultCallIdleSeconds = 60
+)
+
+// Call is a P2P call of the userbot, ntgcalls identifies calls by user id of the peer
+type Call struct {
+	UserId   int64
+	Username string
+	// Id is telegram call id, it is known once telegram acknowledges the call
+	Id        int64
+	Tag       string
+	Protocol  *tg.PhoneCallProtocol
+	Dh        ntgcalls.DhConfig
+	Input     *tg.InputPhoneCall
+	Media     ntgcalls.MediaDescription
+	StartedAt time.Time
+	// Incoming is set for calls made by the user to the userbot
+	Incoming  bool
+	Muted     bool
+	connected bool
+	// idleSince is set while call has no media flowing
+	idleSince time.Time
+}
+
+// CallManager keeps state of concurrent calls and routes telegram updates to them
+type CallManager struct {
+	app   *Application
+	calls map[int64]*Call
+	mutex sync.Mutex
+}
+
+func (m *CallManager) Setup(app *Application) {
+	m.app = app
+	m.calls = make(map[int64]*Call)
+
+	app.ntgClient.OnSignal(m.onSignal)
+	app.ntgClient.OnConnectionChange(m.onConnectionChange)
+
+	app.tgClient.AddRawHandler(&tg.UpdatePhoneCall{}, func(update tg.Update, _ *tg.Client) error {
+		err := m.onPhoneCall(update.(*tg.UpdatePhoneCall).PhoneCall)
+		if err != nil {
+			log.Println("Failed to handle phone call update", err)
+		}
+
+		return nil
+	})
+
+	app.tgClient.AddRawHandler(&tg.UpdatePhoneCallSignalingData{}, func(update tg.Update, _ *tg.Client) error {
+		m.onSignalingData(update.(*tg.UpdatePhoneCallSignalingData))
+		return nil
+	})
+}
+
+func (m *CallManager) Start() {
+	go m.watch()
+}
+
+// Get returns snapshot of the call with the user
+func (m *CallManager) Get(userId int64) (Call, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	call, ok := m.calls[userId]
+	if !ok {
+		return Call{}, false
+	}
+
+	return *call, true
+}
+
+// Active returns snapshots of all calls
+func (m *CallManager) Active() []Call {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	calls := make([]Call, 0, len(m.calls))
+	for _, call := range m.calls {
+		calls = append(calls, *call)
+	}
+
+	return calls
+}
+
+func (m *CallManager) byCallId(callId int64) (Call, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, call := range m.calls {
+		if call.Id == callId {
+			return *call, true
+		}
+	}
+
+	return Call{}, false
+}
+
+// add registers new call, only one call per user is allowed
+func (m *CallManager) add(call *Call) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.calls[call.UserId]; ok {
+		return fmt.Errorf("call with user %v is already active", call.UserId)
+	}
+
+	m.calls[call.UserId] = call
+
+	return nil
+}
+
+// bind links call of the user with telegram call
+func (m *CallManager) bind(userId, callId, accessHash int64) (Call, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	call, ok := m.calls[userId]
+	if !ok {
+		return Call{}, false
+	}
+
+	call.Id = callId
+	call.Input = &tg.InputPhoneCall{ID: callId, AccessHash: accessHash}
+
+	return *call, true
+}
+
+// markConnected returns false when media of the call is already connected
+func (m *CallManager) markConnected(userId int64) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	call, ok := m.calls[userId]
+	if !ok || call.connected {
+		return false
+	}
+
+	call.connected = true
+
+	return true
+}
+
+// remove forgets the call and releases its media, returned call is the last state seen by bind
+func (m *CallManager) remove(userId int64) (Call, bool) {
+	m.mutex.Lock()
+	call, ok := m.calls[userId]
+	delete(m.calls, userId)
+	m.mutex.Unlock()
+
+	if !ok {
+		return Call{}, false
+	}
+
+	err := m.app.ntgClient.Stop(userId)
+	if err != nil {
+		log.Println("Failed to stop call media", userId, err)
+	}
+
+	return *call, true
+}
+
+func (m *CallManager) protocol() *tg.PhoneCallProtocol {
+	protocol := m.app.ntgClient.GetProtocol()
+
+	return &tg.PhoneCallProtocol{
+		UdpP2P:          protocol.UdpP2P,
+		UdpReflector:    protocol.UdpReflector,
+		MinLayer:        protocol.MinLayer,
+		MaxLayer:        protocol.MaxLayer,
+		LibraryVersions: protocol.Versions,
+	}
+}
+
+func (m *CallManager) dhConfig() (ntgcalls.DhConfig, error) {
+	raw, err := m.app.tgClient.MessagesGetDhConfig(0, 256)
+	if err != nil {
+		return ntgcalls.DhConfig{}, fmt.Errorf("failed to get dh config: %w", err)
+	}
+
+	dhConfig, ok := raw.(*tg.MessagesDhConfigObj)
+	if !ok {
+		return ntgcalls.DhConfig{}, fmt.Errorf("unexpected dh config: %T", raw)
+	}
+
+	return ntgcalls.DhConfig{
+		G:      dhConfig.G,
+		P:      dhConfig.P,
+		Random: dhConfig.Random,
+	}, nil
+}
+
+// media describes video and optional audio fed to the call by ffmpeg reading camera stream
+func (m *CallManager) media(tag string) (ntgcalls.MediaDescription, error) {
+	conf, err := m.app.cameras.Config(tag)
+	if err != nil {
+		return ntgcalls.MediaDescription{}, err
+	}
+
+	stream, err := m.app.cameras.Stream(tag, StreamMain)
+	if err != nil {
+		return ntgcalls.MediaDescription{}, err
+	}
+
+	media := ntgcalls.MediaDescription{
+		Video: &ntgcalls.VideoDescription{
+			InputMode: ntgcalls.InputModeShell,
+			Input:     fmt.Sprintf("ffmpeg -i %s -loglevel panic -f rawvideo -r 24 -pix_fmt yuv420p -vf scale=1920:1080 pipe:1", shellQuote(stream)),
+			Width:     1920,
+			Height:    1080,
+			Fps:       24,
+		},
+	}
+
+	if conf.Audio {
+		media.Audio = &ntgcalls.AudioDescription{
+			InputMode:     ntgcalls.InputModeShell,
+			Input:         fmt.Sprintf("ffmpeg -i %s -loglevel panic -vn -f s16le -ac %v -ar %v pipe:1", shellQuote(stream), callAudioChannels, callAudioSampleRate),
+			SampleRate:    callAudioSampleRate,
+			BitsPerSample: 16,
+			ChannelCount:  callAudioChannels,
+		}
+	}
+
+	return media, nil
+}
+
+// shellQuote makes value single shell argument, stream URLs carry & and ? in query
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// Dial requests call with the user streaming the camera
+func (m *CallManager) Dial(user *tg.UserObj, tag string) error {
+	media, err := m.media(tag)
+	if err != nil {
+		return err
+	}
+
+	dh, err := m.dhConfig()
+	if err != nil {
+		return err
+	}
+
+	call := &Call{
+		UserId:    user.ID,
+		Username:  user.Username,
+		Tag:       tag,
+		Protocol:  m.protocol(),
+		Dh:        dh,
+		Media:     media,
+		StartedAt: time.Now(),
+	}
+
+	// slot is reserved before media is created since ntgcalls keys calls by user id
+	err = m.add(call)
+	if err != nil {
+		return err
+	}
+
+	gAHash, err := m.app.ntgClient.CreateP2PCall(user.ID, dh, nil, media)
+	if err != nil {
+		m.remove(user.ID)
+		return fmt.Errorf("failed to create call: %w", err)
+	}
+
+	res, err := m.app.tgClient.PhoneRequestCall(&tg.PhoneRequestCallParams{
+		Protocol: call.Protocol,
+		UserID:   &tg.InputUserObj{UserID: user.ID, AccessHash: user.AccessHash},
+		GAHash:   gAHash,
+		RandomID: int32(tg.GenRandInt()),
+	})
+	if err != nil {
+		m.remove(user.ID)
+		return fmt.Errorf("failed to request call: %w", err)
+	}
+
+	callId, accessHash, ok := phoneCallIds(res.PhoneCall)
+	if !ok {
+		m.remove(user.ID)
+		return fmt.Errorf("call is not requested: %T", res.PhoneCall)
+	}
+
+	if _, ok := m.bind(user.ID, callId, accessHash); !ok {
+		// call is hung up while request was in flight, discard it so the phone stops ringing
+		return m.discard(&tg.InputPhoneCall{ID: callId, AccessHash: accessHash}, 0)
+	}
+
+	log.Println("Call is requested", user.ID, tag)
+
+	return nil
+}
+
+// phoneCallIds returns id and access hash of telegram call when its state carries them
+func phoneCallIds(phoneCall tg.PhoneCall) (int64, int64, bool) {
+	switch phoneCall := phoneCall.(type) {
+	case *tg.PhoneCallWaiting:
+		return phoneCall.ID, phoneCall.AccessHash, true
+	case *tg.PhoneCallRequested:
+		return phoneCall.ID, phoneCall.AccessHash, true
+	case *tg.PhoneCallAccepted:
+		return phoneCall.ID, phoneCall.AccessHash, true
+	case *tg.PhoneCallObj:
+		return phoneCall.ID, phoneCall.AccessHash, true
+	}
+
+	return 0, 0, false
+}
+
+// Switch replaces media of active call with the user without hanging up
+func (m *CallManager) Switch(userId int64, tag string) error {
+	call, ok := m.Get(userId)
+	if !ok {
+		return fmt.Errorf("no active call with user %v", userId)
+	}
+
+	media, err := m.media(tag)
+	if err != nil {
+		return err
+	}
+
+	err = m.app.ntgClient.ChangeStream(userId, media)
+	if err != nil {
+		return fmt.Errorf("failed to switch call to %v camera: %w", tag, err)
+	}
+
+	m.mutex.Lock()
+	if active, ok := m.calls[userId]; ok {
+		active.Tag = tag
+		active.Media = media
+	}
+	m.mutex.Unlock()
+
+	// new stream starts unmuted, muted call stays muted
+	if call.Muted && media.Audio != nil {
+		_, err := m.app.ntgClient.Mute(userId)
+		if err != nil {
+			return fmt.Errorf("failed to keep call muted: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Mute turns off or on audio of the camera in call with the user
+func (m *CallManager) Mute(userId int64, muted bool) error {
+	call, ok := m.Get(userId)
+	if !ok {
+		return fmt.Errorf("no active call with user %v", userId)
+	}
+
+	if call.Media.Audio == nil {
+		return fmt.Errorf("camera %v has no audio", call.Tag)
+	}
+
+	var err error
+	if muted {
+		_, err = m.app.ntgClient.Mute(userId)
+	} else {
+		_, err = m.app.ntgClient.UnMute(userId)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to change call audio: %w", err)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if active, ok := m.calls[userId]; ok {
+		active.Muted = muted
+	}
+
+	return nil
+}
+
+func (m *CallManager) onPhoneCall(phoneCall tg.PhoneCall) error {
+	switch phoneCall := phoneCall.(type) {
+	case *tg.PhoneCallRequested:
+		return m.answer(phoneCall)
+	case *tg.PhoneCallWaiting:
+		m.bind(phoneCall.ParticipantID, phoneCall.ID, phoneCall.AccessHash)
+	case *tg.PhoneCallAccepted:
+		return m.confirm(phoneCall)
+	case *tg.PhoneCallObj:
+		call, ok := m.byCallId(phoneCall.ID)
+		if !ok || !call.Incoming {
+			log.Println("Call is established", phoneCall.ID)
+			return nil
+		}
+
+		return m.establish(call, phoneCall)
+	case *tg.PhoneCallDiscarded:
+		call, ok := m.byCallId(phoneCall.ID)
+		if !ok {
+			return nil
+		}
+
+		log.Println("Call is discarded", call.UserId, phoneCall.Reason)
+		m.remove(call.UserId)
+	default:
+		log.Printf("Unexpected phone call update: %T", phoneCall)
+	}
+
+	return nil
+}
+
+// confirm finishes key exchange of outgoing call accepted by the user
+func (m *CallManager) confirm(accepted *tg.PhoneCallAccepted) error {
+	call, ok := m.bind(accepted.ParticipantID, accepted.ID, accepted.AccessHash)
+	if !ok {
+		return fmt.Errorf("unknown call %v accepted", accepted.ID)
+	}
+
+	auth, err := m.app.ntgClient.ExchangeKeys(call.UserId, accepted.GB, 0)
+	if err != nil {
+		m.remove(call.UserId)
+		return fmt.Errorf("failed to exchange keys: %w", err)
+	}
+
+	res, err := m.app.tgClient.PhoneConfirmCall(call.Input, auth.GAOrB, auth.KeyFingerprint, call.Protocol)
+	if err != nil {
+		m.remove(call.UserId)
+		return fmt.Errorf("failed to confirm call: %w", err)
+	}
+
+	established, ok := res.PhoneCall.(*tg.PhoneCallObj)
+	if !ok {
+		m.remove(call.UserId)
+		return fmt.Errorf("unexpected confirmed call: %T", res.PhoneCall)
+	}
+
+	return m.connect(call, established)
+}
+
+// answer accepts incoming call of permitted user streaming default camera and rejects others
+func (m *CallManager) answer(requested *tg.PhoneCallRequested) (err error) {
+	userId := requested.AdminID
+	input := &tg.InputPhoneCall{ID: requested.ID, AccessHash: requested.AccessHash}
+
+	tag := m.incomingCamera(userId)
+	defer m.audit(userId, tag, time.Now(), &err)
+
+	if tag == "" {
+		log.Println("Incoming call is rejected", userId)
+		m.reject(userId, input, "Sorry, watching cameras by call is not available to you")
+		return ErrNotAllowed
+	}
+
+	media, err := m.media(tag)
+	if err != nil {
+		m.reject(userId, input, "Sorry, camera is not available right now")
+		return err
+	}
+
+	dh, err := m.dhConfig()
+	if err != nil {
+		m.reject(userId, input, "Sorry, camera is not available right now")
+		return err
+	}
+
+	call := &Call{
+		UserId:    userId,
+		Username:  m.username(userId),
+		Id:        requested.ID,
+		Tag:       tag,
+		Protocol:  m.protocol(),
+		Dh:        dh,
+		Input:     input,
+		Media:     media,
+		StartedAt: time.Now(),
+		Incoming:  true,
+	}
+
+	// slot is reserved before media is created since ntgcalls keys calls by user id
+	err = m.add(call)
+	if err != nil {
+		m.reject(userId, input, "You already have an active camera call")
+		return err
+	}
+
+	gB, err := m.app.ntgClient.CreateP2PCall(userId, dh, requested.GAHash, media)
+	if err != nil {
+		m.remove(userId)
+		m.reject(userId, input, "Sorry, camera is not available right now")
+		return fmt.Errorf("failed to create call: %w", err)
+	}
+
+	_, err = m.app.tgClient.PhoneAcceptCall(input, gB, call.Protocol)
+	if err != nil {
+		m.remove(userId)
+		return fmt.Errorf("failed to accept call: %w", err)
+	}
+
+	log.Println("Incoming call is accepted", userId, tag)
+
+	keyboard, err := callKeyboard(m.app, userId, tag)
+	if err != nil {
+		log.Println("Failed to build call buttons", userId, err)
+		return nil
+	}
+
+	_, err = m.app.tgBot.SendMessage(userId, "Streaming camera to your call, switch camera with buttons below", &gotgbot.SendMessageOpts{
+		ReplyMarkup: keyboard,
+	})
+	if err != nil {
+		log.Println("Failed to send call buttons", userId, err)
+	}
+
+	return nil
+}
+
+// incomingCamera returns camera streamed to incoming call of the user, empty when user may not call
+func (m *CallManager) incomingCamera(userId int64) string {
+	tags := m.app.TagsFor(userId, CapCall)
+	if len(tags) == 0 {
+		return ""
+	}
+
+	if slices.Contains(tags, m.app.config.CallCamera) {
+		return m.app.config.CallCamera
+	}
+
+	return tags[0]
+}
+
+// reject discards incoming call and tells the caller why
+func (m *CallManager) reject(userId int64, input *tg.InputPhoneCall, reason string) {
+	_, err := m.app.tgClient.PhoneDiscardCall(&tg.PhoneDiscardCallParams{
+		Peer:   input,
+		Reason: tg.PhoneCallDiscardReasonBusy,
+	})
+	if err != nil {
+		log.Println("Failed to discard call", userId, err)
+	}
+
+	_, err = m.app.tgClient.SendMessage(userId, reason)
+	if err != nil {
+		log.Println("Failed to explain rejected call", userId, err)
+	}
+}
+
+func (m *CallManager) audit(userId int64, tag string, started time.Time, err *error) {
+	outcome, message := auditOutcome(*err)
+
+	m.app.audit.Record(AuditEntry{
+		Time:     started,
+		UserId:   userId,
+		Username: m.username(userId),
+		Kind:     AuditCall,
+		Action:   "incoming",
+		Camera:   tag,
+		Outcome:  outcome,
+		Duration: time.Since(started),
+		Error:    message,
+	})
+}
+
+func (m *CallManager) username(userId int64) string {
+	user, _ := m.app.tgClient.GetUser(userId)
+	if user == nil {
+		return ""
+	}
+
+	return user.Username
+}
+
+// establish finishes key exchange of incoming call once the caller confirms it
+func (m *CallManager) establish(call Call, established *tg.PhoneCallObj) error {
+	_, err := m.app.ntgClient.ExchangeKeys(call.UserId, established.GAOrB, established.KeyFingerprint)
+	if err != nil {
+		m.remove(call.UserId)
+		return fmt.Errorf("failed to exchange keys: %w", err)
+	}
+
+	return m.connect(call, established)
+}
+
+// connect starts media exchange of established call
+func (m *CallManager) connect(call Call, established *tg.PhoneCallObj) error {
+	if !m.markConnected(call.UserId) {
+		return nil
+	}
+
+	rtcServers := make([]ntgcalls.RTCServer, 0, len(established.Connections))
+	for _, connection := range established.Connections {
+		switch connection := connection.(type) {
+		case *tg.PhoneConnectionWebrtc:
+			rtcServers = append(rtcServers, ntgcalls.RTCServer{
+				ID:       connection.ID,
+				Ipv4:     connection.Ip,
+				Ipv6:     connection.Ipv6,
+				Username: connection.Username,
+				Password: connection.Password,
+				Port:     connection.Port,
+				Turn:     connection.Turn,
+				Stun:     connection.Stun,
+			})
+		case *tg.PhoneConnectionObj:
+			rtcServers = append(rtcServers, ntgcalls.RTCServer{
+				ID:      connection.ID,
+				Ipv4:    connection.Ip,
+				Ipv6:    connection.Ipv6,
+				Port:    connection.Port,
+				Turn:    true,
+				Tcp:     connection.Tcp,
+				PeerTag: connection.PeerTag,
+			})
+		}
+	}
+
+	err := m.app.ntgClient.ConnectP2P(call.UserId, rtcServers, established.Protocol.LibraryVersions, established.P2PAllowed)
+	if err != nil {
+		m.remove(call.UserId)
+		return fmt.Errorf("failed to connect call: %w", err)
+	}
+
+	return nil
+}
+
+// onSignal forwards signaling data produced by ntgcalls to telegram call of the user
+func (m *CallManager) onSignal(chatId int64, signal []byte) {
+	call, ok := m.Get(chatId)
+	if !ok || call.Input == nil {
+		log.Println("Signal for unknown call is dropped", chatId)
+		return
+	}
+
+	_, err := m.app.tgClient.PhoneSendSignalingData(call.Input, signal)
+	if err != nil {
+		log.Println("Failed to send signaling data", chatId, err)
+	}
+}
+
+// onSignalingData forwards signaling data received from telegram to ntgcalls
+func (m *CallManager) onSignalingData(update *tg.UpdatePhoneCallSignalingData) {
+	call, ok := m.byCallId(update.PhoneCallID)
+	if !ok {
+		log.Println("Signaling data for unknown call is dropped", update.PhoneCallID)
+		return
+	}
+
+	err := m.app.ntgClient.SendSignalingData(call.UserId, update.Data)
+	if err != nil {
+		log.Println("Failed to pass signaling data", call.UserId, err)
+	}
+}
+
+// Hangup discards call with the user and stops its media
+func (m *CallManager) Hangup(userId int64) error {
+	call, ok := m.remove(userId)
+	if !ok {
+		return fmt.Errorf("no active call with user %v", userId)
+	}
+
+	// unbound call is discarded by Dial once telegram returns it
+	if call.Input == nil {
+		return nil
+	}
+
+	return m.discard(call.Input, time.Since(call.StartedAt))
+}
+
+func (m *CallManager) discard(input *tg.InputPhoneCall, duration time.Duration) error {
+	_, err := m.app.tgClient.PhoneDiscardCall(&tg.PhoneDiscardCallParams{
+		Peer:     input,
+		Duration: int32(duration.Seconds()),
+		Reason:   tg.PhoneCallDiscardReasonHangup,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to discard call: %w", err)
+	}
+
+	return nil
+}
+
+// Streamed returns how long media of the call has been streamed
+func (m *CallManager) Streamed(userId int64) (time.Duration, error) {
+	seconds, err := m.app.ntgClient.Time(userId)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// end hangs up call ended by the bot and tells the user why
+func (m *CallManager) end(userId int64, reason string) {
+	if _, ok := m.Get(userId); !ok {
+		return
+	}
+
+	log.Println("Call is ended", userId, reason)
+
+	err := m.Hangup(userId)
+	if err != nil {
+		log.Println("Failed to hang up call", userId, err)
+	}
+
+	_, err = m.app.tgBot.SendMessage(userId, fmt.Sprintf("Camera call ended: %v", reason), &gotgbot.SendMessageOpts{})
+	if err != nil {
+		log.Println("Failed to notify about ended call", userId, err)
+	}
+}
+
+func (m *CallManager) onConnectionChange(chatId int64, state ntgcalls.ConnectionState) {
+	switch state {
+	case ntgcalls.Failed, ntgcalls.Timeout:
+		m.end(chatId, "connection is lost")
+	case ntgcalls.Closed:
+		m.remove(chatId)
+	}
+}
+
+// watch ends calls exceeding max duration and calls idle for too long,
+// call is idle until it is connected and while its stream is idling
+func (m *CallManager) watch() {
+	ticker := time.NewTicker(callWatchInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		statuses := m.app.ntgClient.Calls()
+		ended := make(map[int64]string)
+
+		m.mutex.Lock()
+		for userId, call := range m.calls {
+			if now.Sub(call.StartedAt) > m.app.config.CallMaxDuration() {
+				ended[userId] = "maximum call duration is reached"
+				continue
+			}
+
+			status, ok := statuses[userId]
+			if call.connected && ok && status != ntgcalls.IdlingStream {
+				call.idleSince = time.Time{}
+				continue
+			}
+
+			if call.idleSince.IsZero() {
+				call.idleSince = now
+			}
+
+			if now.Sub(call.idleSince) > m.app.config.CallIdleTimeout() {
+				ended[userId] = "call is idle"
+			}
+		}
+		m.mutex.Unlock()
+
+		for userId, reason := range ended {
+			m.end(userId, reason)
+		}
+	}
+}
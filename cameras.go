@@ -2,19 +2,19 @@ package main
 
 import (
 	"fmt"
-	"io"
 	"net/http"
-	"os"
 	"slices"
 	"sync"
 	"time"
-
-	"github.com/icholy/digest"
 )
 
+// resolveRetryInterval is delay between attempts to resolve URLs of camera unreachable at startup
+const resolveRetryInterval = time.Minute
+
 type Cameras struct {
 	clients  map[string]*http.Client
 	checkers map[string]*http.Client
+	drivers  map[string]CameraDriver
 	configs  []CameraConfig
 }
 
@@ -28,18 +28,31 @@ func (cs *Cameras) Setup(configs []CameraConfig) error {
 	cs.configs = configs
 	cs.clients = make(map[string]*http.Client)
 	cs.checkers = make(map[string]*http.Client)
+	cs.drivers = make(map[string]CameraDriver)
 
 	for _, conf := range cs.configs {
-		if conf.Pass == "" {
+		if conf.Pass == "" && conf.Auth != AuthNone {
 			return fmt.Errorf("missing password for camera with tag: %v", conf.Tag)
 		}
 
+		driver, err := NewCameraDriver(conf)
+		if err != nil {
+			return err
+		}
+
 		client := &http.Client{
-			Transport: &digest.Transport{
-				Username: conf.User,
-				Password: conf.Pass,
-			},
-			Timeout: time.Second * 2,
+			Transport: driver.Transport(),
+			Timeout:   time.Second * 2,
+		}
+
+		if resolvable, ok := driver.(ResolvableDriver); ok {
+			err = resolvable.Resolve(client)
+			if err != nil {
+				fmt.Println("Failed to resolve camera urls, camera is unavailable until resolved", conf.Tag, err)
+				go cs.resolveLater(conf.Tag, resolvable, client)
+			} else {
+				fmt.Println("Camera urls resolved", conf.Tag, driver.SnapshotURL(StreamMain))
+			}
 		}
 
 		checker := &http.Client{
@@ -47,6 +60,7 @@ func (cs *Cameras) Setup(configs []CameraConfig) error {
 		}
 
 		cs.checkers[conf.Tag] = checker
+		cs.drivers[conf.Tag] = driver
 
 		cs.Set(conf.Tag, client)
 	}
@@ -54,6 +68,83 @@ func (cs *Cameras) Setup(configs []CameraConfig) error {
 	return nil
 }
 
+// resolveLater retries resolving URLs of camera until it succeeds
+func (cs *Cameras) resolveLater(tag string, resolvable ResolvableDriver, client *http.Client) {
+	ticker := time.NewTicker(resolveRetryInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := resolvable.Resolve(client)
+		if err != nil {
+			fmt.Println("Failed to resolve camera urls", tag, err)
+			continue
+		}
+
+		fmt.Println("Camera urls resolved", tag)
+		return
+	}
+}
+
+// StreamingClient returns camera client without timeout for long living responses
+func (cs *Cameras) StreamingClient(tag string) (*http.Client, error) {
+	client, err := cs.Get(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	streamingClient := *client
+	streamingClient.Timeout = 0
+
+	return &streamingClient, nil
+}
+
+func (cs *Cameras) Config(tag string) (CameraConfig, error) {
+	for _, config := range cs.configs {
+		if config.Tag == tag {
+			return config, nil
+		}
+	}
+
+	return CameraConfig{}, fmt.Errorf("no camera config found for %v", tag)
+}
+
+func (cs *Cameras) Driver(tag string) (CameraDriver, error) {
+	if cs.drivers[tag] == nil {
+		return nil, fmt.Errorf("no camera driver found for %v", tag)
+	}
+
+	return cs.drivers[tag], nil
+}
+
+func (cs *Cameras) Stream(tag, stream string) (string, error) {
+	driver, err := cs.Driver(tag)
+	if err != nil {
+		return "", err
+	}
+
+	return driver.StreamURL(stream), nil
+}
+
+func (cs *Cameras) GetImage(tag, stream string) ([]byte, error) {
+	cameraClient, err := cs.Get(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, err := cs.Driver(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := FetchSnapshot(driver, cameraClient, stream)
+	if err != nil && stream != StreamMain {
+		fmt.Println("Failed to get camera image from stream, falling back to main", tag, stream, err)
+		return FetchSnapshot(driver, cameraClient, StreamMain)
+	}
+
+	return data, err
+}
+
 func (cs *Cameras) Get(tag string) (*http.Client, error) {
 	if cs.clients[tag] == nil {
 		return nil, fmt.Errorf("no camera client found for %v", tag)
@@ -62,8 +153,9 @@ func (cs *Cameras) Get(tag string) (*http.Client, error) {
 	return cs.clients[tag], nil
 }
 
-func (cs *Cameras) GetAllImages(tags []string) map[string][]byte {
+func (cs *Cameras) GetAllImages(tags []string, stream string) map[string][]byte {
 	m := make(map[string][]byte)
+	mux := sync.Mutex{}
 
 	wg := sync.WaitGroup{}
 	for _, config := range cs.configs {
@@ -74,33 +166,19 @@ func (cs *Cameras) GetAllImages(tags []string) map[string][]byte {
 		wg.Add(1)
 
 		go func(tag string) {
-			cameraClient, err := cs.Get(tag)
-			if err != nil {
-				panic(err)
-			}
-
-			failedDueTimeout := false
+			defer wg.Done()
 
-			cameraResponse, err := cameraClient.Get(config.Image())
+			data, err := cs.GetImage(tag, stream)
 			if err != nil {
-				fmt.Println("Request error by timeout", err)
-				failedDueTimeout = true
+				fmt.Println("Failed to get camera image", tag, err)
+				return
 			}
 
-			if !failedDueTimeout && cameraResponse.StatusCode == 200 {
-				defer cameraResponse.Body.Close()
-
-				fmt.Println("Camera response", tag, cameraResponse.StatusCode)
+			fmt.Println("Camera image received", tag)
 
-				data, err := io.ReadAll(cameraResponse.Body)
-				if err != nil {
-					fmt.Println("failed to read cameraResponse.Body")
-					panic(err)
-				}
-
-				m[tag] = data
-			}
-			wg.Done()
+			mux.Lock()
+			m[tag] = data
+			mux.Unlock()
 		}(config.Tag)
 	}
 	wg.Wait()
@@ -110,28 +188,26 @@ func (cs *Cameras) GetAllImages(tags []string) map[string][]byte {
 
 func (cs *Cameras) CheckAvailableCameras() (map[string]bool, error) {
 	cameraStatuses := make(map[string]bool)
+	mux := sync.Mutex{}
+
 	wg := sync.WaitGroup{}
 	for _, config := range cs.configs {
 		checker := cs.checkers[config.Tag]
-		if checker == nil {
+		driver := cs.drivers[config.Tag]
+		if checker == nil || driver == nil {
 			continue
 		}
 
 		wg.Add(1)
-		go func() {
-			res, err := checker.Get(config.Image())
-			if err != nil || os.IsTimeout(err) || res == nil {
-				cameraStatuses[config.Tag] = false
-				wg.Done()
-				return
-			}
+		go func(tag string) {
+			defer wg.Done()
 
-			if res.StatusCode == 401 {
-				cameraStatuses[config.Tag] = true
-				wg.Done()
-				return
-			}
-		}()
+			available := driver.Probe(checker)
+
+			mux.Lock()
+			cameraStatuses[tag] = available
+			mux.Unlock()
+		}(config.Tag)
 	}
 	wg.Wait()
 
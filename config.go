@@ -6,13 +6,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/fs"
-	"net/url"
 	"os"
 	"path"
+	"slices"
+	"time"
 )
 
 var TimeRanges = []string{"05", "15", "30", "60"}
 
+var RewindRanges = []string{"30", "60", "300"}
+
+// PlaybackDays is amount of days offered by playback day picker
+const PlaybackDays = 9
+
+// PlaybackWindow is length of recording fetched from camera storage
+const PlaybackWindow = time.Minute
+
 type Config struct {
 	AppHash     string              `json:"app_hash"`
 	BotToken    string              `json:"bot_token"`
@@ -20,6 +29,21 @@ type Config struct {
 	Permissions []CameraPermissions `json:"permissions"`
 	AppId       int32               `json:"app_id"`
 	AdminId     int64               `json:"admin_id"`
+	// TimelapseHour is hour of day when yesterday timelapse is delivered
+	TimelapseHour int `json:"timelapse_hour"`
+	// CallCamera is tag of camera streamed to incoming calls, first permitted camera is used when empty
+	CallCamera string `json:"call_camera"`
+	// CallMaxMinutes is duration after which call is ended
+	CallMaxMinutes int `json:"call_max_minutes"`
+	// CallIdleSeconds is duration of call without media after which call is ended
+	CallIdleSeconds int `json:"call_idle_seconds"`
+	// AuditPings is one of each, digest or off, each by default
+	AuditPings string `json:"audit_pings"`
+	// AuditDigestInterval is minutes between digests when AuditPings is digest
+	AuditDigestInterval int `json:"audit_digest_interval"`
+	// AuditRetentionDays is how long audit entries are kept
+	AuditRetentionDays int          `json:"audit_retention_days"`
+	Limits             LimitsConfig `json:"limits"`
 }
 
 func (c Config) String() string {
@@ -48,23 +72,101 @@ func (c *Config) GetTmpRecordingPath(userId int64, hashSeed string) (string, err
 	return path.Join(configDir, fileName), nil
 }
 
-func (c *Config) GetSessionPath() (string, error) {
+func (c *Config) GetTmpClipPath(hashSeed string) (string, error) {
 	configDir, err := c.GetConfigPath()
 	if err != nil {
 		return "", err
 	}
 
-	return path.Join(configDir, "session"), nil
+	hash := hashify([]byte(hashSeed))
+
+	fileName := fmt.Sprintf("clip_%v.mp4", hash)
+
+	return path.Join(configDir, fileName), nil
 }
 
-func (c *Config) GetPermissionsFor(userId int64) *CameraPermissions {
-	for _, permissions := range c.Permissions {
-		if permissions.UserId == userId {
-			return &permissions
-		}
+func (c *Config) GetBufferPath(tag string) (string, error) {
+	configDir, err := c.GetConfigPath()
+	if err != nil {
+		return "", err
 	}
 
-	return nil
+	return path.Join(configDir, "buffer", tag), nil
+}
+
+func (c *Config) GetTimelapsePath(tag string) (string, error) {
+	configDir, err := c.GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(configDir, "timelapse", tag), nil
+}
+
+func (c *Config) TimelapseHourOfDay() int {
+	if c.TimelapseHour == 0 {
+		return defaultTimelapseHour
+	}
+
+	return c.TimelapseHour
+}
+
+func (c *Config) AuditPingsMode() string {
+	if c.AuditPings == "" {
+		return AuditPingsEach
+	}
+
+	return c.AuditPings
+}
+
+func (c *Config) AuditDigestDuration() time.Duration {
+	if c.AuditDigestInterval == 0 {
+		return defaultAuditDigestInterval * time.Minute
+	}
+
+	return time.Duration(c.AuditDigestInterval) * time.Minute
+}
+
+func (c *Config) AuditRetention() time.Duration {
+	if c.AuditRetentionDays == 0 {
+		return defaultAuditRetentionDays * 24 * time.Hour
+	}
+
+	return time.Duration(c.AuditRetentionDays) * 24 * time.Hour
+}
+
+func (c *Config) CallMaxDuration() time.Duration {
+	if c.CallMaxMinutes == 0 {
+		return defaultCallMaxMinutes * time.Minute
+	}
+
+	return time.Duration(c.CallMaxMinutes) * time.Minute
+}
+
+func (c *Config) CallIdleTimeout() time.Duration {
+	if c.CallIdleSeconds == 0 {
+		return defaultCallIdleSeconds * time.Second
+	}
+
+	return time.Duration(c.CallIdleSeconds) * time.Second
+}
+
+func (c *Config) GetStorePath() (string, error) {
+	configDir, err := c.GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(configDir, "state.db"), nil
+}
+
+func (c *Config) GetSessionPath() (string, error) {
+	configDir, err := c.GetConfigPath()
+	if err != nil {
+		return "", err
+	}
+
+	return path.Join(configDir, "session"), nil
 }
 
 func (c *Config) Setup() error {
@@ -85,50 +187,190 @@ func (c *Config) Setup() error {
 		return err
 	}
 
+	for _, camera := range c.Cameras {
+		if (len(camera.Channels) > 0 || camera.Channel != 0) && !camera.SupportsChannels() {
+			return fmt.Errorf("driver %q of camera %v (%v) does not support channels", camera.Driver, camera.Name, camera.Tag)
+		}
+	}
+
+	c.Cameras = expandChannels(c.Cameras)
+
+	for _, camera := range c.Cameras {
+		err := validateCallbackTag(camera.Tag)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !slices.Contains([]string{AuditPingsEach, AuditPingsDigest, AuditPingsOff}, c.AuditPingsMode()) {
+		return fmt.Errorf("unknown audit_pings mode: %v", c.AuditPings)
+	}
+
+	if c.CallCamera != "" && !slices.ContainsFunc(c.Cameras, func(camera CameraConfig) bool { return camera.Tag == c.CallCamera }) {
+		return fmt.Errorf("unknown call_camera: %v", c.CallCamera)
+	}
+
+	for _, permissions := range c.Permissions {
+		for _, rule := range permissions.Schedule {
+			err := rule.Validate()
+			if err != nil {
+				return fmt.Errorf("invalid schedule of user %v: %w", permissions.UserId, err)
+			}
+		}
+	}
+
 	return nil
 }
 
+// expandChannels turns every NVR entry with channels into separate logical cameras
+func expandChannels(configs []CameraConfig) []CameraConfig {
+	cameras := make([]CameraConfig, 0, len(configs))
+
+	for _, conf := range configs {
+		if len(conf.Channels) == 0 {
+			cameras = append(cameras, conf)
+			continue
+		}
+
+		for _, channel := range conf.Channels {
+			camera := conf
+			camera.Channels = nil
+			camera.Tag = channel.Tag
+			camera.Name = channel.Name
+			camera.Channel = channel.Channel
+
+			cameras = append(cameras, camera)
+		}
+	}
+
+	return cameras
+}
+
 type CameraConfig struct {
-	Tag  string `json:"tag"`
-	Name string `json:"name"`
-	User string `json:"user"`
-	Pass string `json:"pass"`
-	Host string `json:"host"`
+	Tag            string          `json:"tag"`
+	Name           string          `json:"name"`
+	User           string          `json:"user"`
+	Pass           string          `json:"pass"`
+	Host           string          `json:"host"`
+	Driver         string          `json:"driver"`
+	Auth           string          `json:"auth"`
+	SnapshotURL    string          `json:"snapshot_url"`
+	StreamURL      string          `json:"stream_url"`
+	SubSnapshotURL string          `json:"sub_snapshot_url"`
+	SubStreamURL   string          `json:"sub_stream_url"`
+	OnvifURL       string          `json:"onvif_url"`
+	OnvifProfile   string          `json:"onvif_profile"`
+	Channels       []ChannelConfig `json:"channels"`
+	Channel        int             `json:"channel"`
+	RtspPort       int             `json:"rtsp_port"`
+	Alerts         bool            `json:"alerts"`
+	AlertEvents    []string        `json:"alert_events"`
+	AlertCooldown  int             `json:"alert_cooldown"`
+	AlertClip      int             `json:"alert_clip"`
+	// AlertPreRoll is amount of seconds before event included into clip, requires buffer
+	AlertPreRoll int `json:"alert_pre_roll"`
+	// AlertPostRoll is amount of seconds after event included into clip, alert_clip is used when missing
+	AlertPostRoll int          `json:"alert_post_roll"`
+	Motion        MotionConfig `json:"motion"`
+	// Buffer is amount of minutes of continuous recording kept on disk for rewind
+	Buffer int `json:"buffer"`
+	// Audio adds camera microphone to video calls
+	Audio      bool            `json:"audio"`
+	Ptz        bool            `json:"ptz"`
+	PtzPresets []PtzPreset     `json:"ptz_presets"`
+	Timelapse  TimelapseConfig `json:"timelapse"`
 }
 
 func (c CameraConfig) String() string {
-	return fmt.Sprintf("{Name: %v, Tag: %v, Host: %v}", c.Name, c.Tag, c.Host)
+	return fmt.Sprintf("{Name: %v, Tag: %v, Host: %v, Driver: %v, Channel: %v}", c.Name, c.Tag, c.Host, c.Driver, c.ChannelNumber())
+}
+
+// AlertEventTypes returns ISAPI event types camera should notify about
+func (c *CameraConfig) AlertEventTypes() []string {
+	if len(c.AlertEvents) == 0 {
+		return defaultAlertEvents
+	}
+
+	return c.AlertEvents
+}
+
+// AlertCooldownSeconds returns minimal interval between two notifications of the camera
+func (c *CameraConfig) AlertCooldownSeconds() int {
+	if c.AlertCooldown == 0 {
+		return defaultAlertCooldown
+	}
+
+	return c.AlertCooldown
 }
 
-func (c *CameraConfig) Image() string {
-	url := url.URL{
-		Scheme:   "http",
-		Host:     c.Host,
-		Path:     "ISAPI/Streaming/channels/101/picture",
-		RawQuery: "snapShotImageType=JPEG",
+// AlertClipSeconds returns length of the clip sent with notification
+func (c *CameraConfig) AlertClipSeconds() int {
+	if c.AlertClip == 0 {
+		return defaultAlertClip
 	}
 
-	return url.String()
+	return c.AlertClip
 }
 
-func (c *CameraConfig) Stream() string {
-	url := url.URL{
-		Scheme: "rtsp",
-		Host:   fmt.Sprintf("%v:%v", c.Host, 554),
-		User:   url.UserPassword(c.User, c.Pass),
-		Path:   "ISAPI/Streaming/Channels/101",
+// AlertPadding returns clip padding before and after the event
+func (c *CameraConfig) AlertPadding() (time.Duration, time.Duration) {
+	postRoll := c.AlertPostRoll
+	if postRoll == 0 {
+		postRoll = c.AlertClipSeconds()
 	}
 
-	return url.String()
+	return time.Duration(c.AlertPreRoll) * time.Second, time.Duration(postRoll) * time.Second
+}
+
+// ChannelNumber returns configured channel, cameras without NVR use the first one
+func (c *CameraConfig) ChannelNumber() int {
+	if c.Channel == 0 {
+		return 1
+	}
+
+	return c.Channel
+}
+
+// SupportsChannels reports whether driver addresses NVR channels, other drivers would show the same stream for every channel
+func (c *CameraConfig) SupportsChannels() bool {
+	return slices.Contains([]string{"", DriverHikvision, DriverDahua}, c.Driver)
+}
+
+// AuthScheme returns configured auth scheme or driver's default one
+func (c *CameraConfig) AuthScheme(fallback string) string {
+	if c.Auth == "" {
+		return fallback
+	}
+
+	return c.Auth
+}
+
+// ChannelConfig describes one NVR channel exposed as a separate logical camera
+type ChannelConfig struct {
+	Tag     string `json:"tag"`
+	Name    string `json:"name"`
+	Channel int    `json:"channel"`
 }
 
 type CameraPermissions struct {
-	Tags   []string ``
-	UserId int64    `json:"user_id"`
+	Tags []string ``
+	// Role applies to all cameras of the user, RoleUser is used when empty
+	Role string `json:"role,omitempty"`
+	// CameraRoles overrides Role for particular cameras
+	CameraRoles map[string]string `json:"camera_roles,omitempty"`
+	// Schedule limits access to time windows, access is not limited when empty
+	Schedule []ScheduleRule `json:"schedule,omitempty"`
+	// Unlimited exempts user from rate limits and recording quotas
+	Unlimited bool `json:"unlimited,omitempty"`
+	// Ptz lists tags of cameras user is allowed to turn, viewing permission is still required
+	Ptz []string `json:"ptz"`
+	// Timelapse lists tags of cameras which daily timelapse user receives
+	Timelapse []string `json:"timelapse"`
+	UserId    int64    `json:"user_id"`
 }
 
 func (p CameraPermissions) String() string {
-	return fmt.Sprintf("{UserId: %v, Tags: %v}", p.UserId, p.Tags)
+	return fmt.Sprintf("{UserId: %v, Tags: %v, Role: %v, CameraRoles: %v, Schedule: %v, Ptz: %v, Timelapse: %v, Unlimited: %v}", p.UserId, p.Tags, p.RoleFor(""), p.CameraRoles, p.Schedule, p.Ptz, p.Timelapse, p.Unlimited)
 }
 
 func hashify(bytes []byte) string {
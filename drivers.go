@@ -0,0 +1,410 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+
+	"github.com/icholy/digest"
+)
+
+const (
+	DriverHikvision = "hikvision"
+	DriverDahua     = "dahua"
+	DriverHTTP      = "http"
+	DriverOnvif     = "onvif"
+)
+
+const (
+	StreamMain = "main"
+	StreamSub  = "sub"
+)
+
+var Streams = []string{StreamMain, StreamSub}
+
+const (
+	AuthDigest = "digest"
+	AuthBasic  = "basic"
+	AuthNone   = "none"
+)
+
+// CameraDriver knows how to talk to a specific camera vendor or protocol.
+type CameraDriver interface {
+	// SnapshotURL returns URL of a single JPEG frame of the named stream
+	SnapshotURL(stream string) string
+	// StreamURL returns RTSP URL of the named stream with credentials included
+	StreamURL(stream string) string
+	// Transport returns round tripper implementing camera auth scheme
+	Transport() http.RoundTripper
+	// Probe checks that camera is reachable using unauthenticated checker client
+	Probe(checker *http.Client) bool
+}
+
+func NewCameraDriver(conf CameraConfig) (CameraDriver, error) {
+	switch conf.Auth {
+	case "", AuthDigest, AuthBasic, AuthNone:
+	default:
+		return nil, fmt.Errorf("unknown auth scheme %q for camera with tag: %v", conf.Auth, conf.Tag)
+	}
+
+	switch conf.Driver {
+	case "", DriverHikvision:
+		return &HikvisionDriver{conf}, nil
+	case DriverDahua:
+		return &DahuaDriver{conf}, nil
+	case DriverHTTP:
+		if conf.SnapshotURL == "" {
+			return nil, fmt.Errorf("missing snapshot_url for camera with tag: %v", conf.Tag)
+		}
+		return &HTTPSnapshotDriver{conf}, nil
+	case DriverOnvif:
+		return &OnvifDriver{conf: conf}, nil
+	default:
+		return nil, fmt.Errorf("unknown driver %q for camera with tag: %v", conf.Driver, conf.Tag)
+	}
+}
+
+// FetchSnapshot downloads single frame from camera using authenticated client
+func FetchSnapshot(driver CameraDriver, client *http.Client, stream string) ([]byte, error) {
+	res, err := client.Get(driver.SnapshotURL(stream))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected snapshot response status: %v", res.StatusCode)
+	}
+
+	return io.ReadAll(res.Body)
+}
+
+func authTransport(scheme, user, pass string) (http.RoundTripper, error) {
+	switch scheme {
+	case AuthDigest:
+		return &digest.Transport{
+			Username: user,
+			Password: pass,
+		}, nil
+	case AuthBasic:
+		return &basicTransport{
+			username: user,
+			password: pass,
+		}, nil
+	case AuthNone:
+		return http.DefaultTransport, nil
+	default:
+		return nil, fmt.Errorf("unknown auth scheme: %v", scheme)
+	}
+}
+
+type basicTransport struct {
+	username string
+	password string
+}
+
+func (t *basicTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(t.username, t.password)
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// probeAuthRequired treats 401 as a sign of a live camera behind auth
+func probeAuthRequired(checker *http.Client, snapshotURL string) bool {
+	res, err := checker.Get(snapshotURL)
+	if err != nil || res == nil {
+		return false
+	}
+	defer res.Body.Close()
+
+	return res.StatusCode == http.StatusUnauthorized
+}
+
+// probeReachable treats any HTTP response as a live camera
+func probeReachable(checker *http.Client, snapshotURL string) bool {
+	res, err := checker.Get(snapshotURL)
+	if err != nil || res == nil {
+		return false
+	}
+	defer res.Body.Close()
+
+	return true
+}
+
+func rtspURL(conf CameraConfig, path, query string) string {
+	port := conf.RtspPort
+	if port == 0 {
+		port = 554
+	}
+
+	url := url.URL{
+		Scheme:   "rtsp",
+		Host:     fmt.Sprintf("%v:%v", conf.Host, port),
+		User:     url.UserPassword(conf.User, conf.Pass),
+		Path:     path,
+		RawQuery: query,
+	}
+
+	return url.String()
+}
+
+func withCredentials(rawURL, user, pass string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User != nil || user == "" {
+		return rawURL
+	}
+
+	u.User = url.UserPassword(user, pass)
+
+	return u.String()
+}
+
+// HikvisionDriver uses ISAPI endpoints
+type HikvisionDriver struct {
+	conf CameraConfig
+}
+
+// streamID combines channel and stream number, e.g. 101 is channel 1 main stream and 202 is channel 2 substream
+func (d *HikvisionDriver) streamID(stream string) string {
+	streamNumber := 1
+	if stream == StreamSub {
+		streamNumber = 2
+	}
+
+	return fmt.Sprintf("%d%02d", d.conf.ChannelNumber(), streamNumber)
+}
+
+func (d *HikvisionDriver) SnapshotURL(stream string) string {
+	url := url.URL{
+		Scheme:   "http",
+		Host:     d.conf.Host,
+		Path:     fmt.Sprintf("ISAPI/Streaming/channels/%v/picture", d.streamID(stream)),
+		RawQuery: "snapShotImageType=JPEG",
+	}
+
+	return url.String()
+}
+
+func (d *HikvisionDriver) StreamURL(stream string) string {
+	return rtspURL(d.conf, fmt.Sprintf("ISAPI/Streaming/Channels/%v", d.streamID(stream)), "")
+}
+
+func (d *HikvisionDriver) Transport() http.RoundTripper {
+	transport, _ := authTransport(d.conf.AuthScheme(AuthDigest), d.conf.User, d.conf.Pass)
+	return transport
+}
+
+func (d *HikvisionDriver) Probe(checker *http.Client) bool {
+	return probeAuthRequired(checker, d.SnapshotURL(StreamMain))
+}
+
+func (d *HikvisionDriver) AlertStreamURL() string {
+	url := url.URL{
+		Scheme: "http",
+		Host:   d.conf.Host,
+		Path:   "ISAPI/Event/notification/alertStream",
+	}
+
+	return url.String()
+}
+
+// DahuaDriver uses Dahua CGI endpoints
+type DahuaDriver struct {
+	conf CameraConfig
+}
+
+func (d *DahuaDriver) subtype(stream string) int {
+	if stream == StreamSub {
+		return 1
+	}
+
+	return 0
+}
+
+func (d *DahuaDriver) SnapshotURL(stream string) string {
+	url := url.URL{
+		Scheme:   "http",
+		Host:     d.conf.Host,
+		Path:     "cgi-bin/snapshot.cgi",
+		RawQuery: fmt.Sprintf("channel=%v&subtype=%v", d.conf.ChannelNumber(), d.subtype(stream)),
+	}
+
+	return url.String()
+}
+
+func (d *DahuaDriver) StreamURL(stream string) string {
+	return rtspURL(d.conf, "cam/realmonitor", fmt.Sprintf("channel=%v&subtype=%v", d.conf.ChannelNumber(), d.subtype(stream)))
+}
+
+func (d *DahuaDriver) Transport() http.RoundTripper {
+	transport, _ := authTransport(d.conf.AuthScheme(AuthDigest), d.conf.User, d.conf.Pass)
+	return transport
+}
+
+func (d *DahuaDriver) Probe(checker *http.Client) bool {
+	return probeAuthRequired(checker, d.SnapshotURL(StreamMain))
+}
+
+// HTTPSnapshotDriver uses explicitly configured snapshot and stream URLs
+type HTTPSnapshotDriver struct {
+	conf CameraConfig
+}
+
+func (d *HTTPSnapshotDriver) SnapshotURL(stream string) string {
+	if stream == StreamSub && d.conf.SubSnapshotURL != "" {
+		return d.conf.SubSnapshotURL
+	}
+
+	return d.conf.SnapshotURL
+}
+
+func (d *HTTPSnapshotDriver) StreamURL(stream string) string {
+	streamURL := d.conf.StreamURL
+	if stream == StreamSub && d.conf.SubStreamURL != "" {
+		streamURL = d.conf.SubStreamURL
+	}
+
+	return withCredentials(streamURL, d.conf.User, d.conf.Pass)
+}
+
+func (d *HTTPSnapshotDriver) Transport() http.RoundTripper {
+	transport, _ := authTransport(d.conf.AuthScheme(AuthBasic), d.conf.User, d.conf.Pass)
+	return transport
+}
+
+func (d *HTTPSnapshotDriver) Probe(checker *http.Client) bool {
+	return probeReachable(checker, d.SnapshotURL(StreamMain))
+}
+
+// ResolvableDriver is implemented by drivers which discover their URLs from camera at startup
+type ResolvableDriver interface {
+	Resolve(client *http.Client) error
+}
+
+// OnvifDriver serves Profile S snapshot and stream URIs,
+// first media profile (or configured one) is main stream and the next one is substream
+type OnvifDriver struct {
+	conf         CameraConfig
+	mu           sync.RWMutex
+	snapshotURLs map[string]string
+	streamURLs   map[string]string
+}
+
+// DeviceURL returns ONVIF device service address
+func (d *OnvifDriver) DeviceURL() string {
+	if d.conf.OnvifURL != "" {
+		return d.conf.OnvifURL
+	}
+
+	url := url.URL{
+		Scheme: "http",
+		Host:   d.conf.Host,
+		Path:   "onvif/device_service",
+	}
+
+	return url.String()
+}
+
+// Resolve asks camera media service for snapshot and stream URIs of the configured profile
+func (d *OnvifDriver) Resolve(client *http.Client) error {
+	onvif := NewOnvifClient(d.DeviceURL(), d.conf.User, d.conf.Pass, client)
+
+	mediaURL, err := onvif.MediaURL()
+	if err != nil {
+		return err
+	}
+
+	profiles, err := onvif.GetProfiles(mediaURL)
+	if err != nil {
+		return err
+	}
+	if len(profiles) == 0 {
+		return fmt.Errorf("no onvif media profiles found")
+	}
+
+	mainProfile := 0
+	if d.conf.OnvifProfile != "" {
+		mainProfile = slices.Index(profiles, d.conf.OnvifProfile)
+		if mainProfile == -1 {
+			return fmt.Errorf("onvif profile %q not found in %v", d.conf.OnvifProfile, profiles)
+		}
+	}
+
+	streamProfiles := map[string]string{
+		StreamMain: profiles[mainProfile],
+	}
+	if mainProfile+1 < len(profiles) {
+		streamProfiles[StreamSub] = profiles[mainProfile+1]
+	}
+
+	snapshotURLs := make(map[string]string)
+	streamURLs := make(map[string]string)
+
+	for stream, profile := range streamProfiles {
+		snapshotURL, err := onvif.GetSnapshotUri(mediaURL, profile)
+		if err != nil {
+			return err
+		}
+
+		streamURL, err := onvif.GetStreamUri(mediaURL, profile)
+		if err != nil {
+			return err
+		}
+
+		snapshotURLs[stream] = snapshotURL
+		streamURLs[stream] = streamURL
+	}
+
+	d.mu.Lock()
+	d.snapshotURLs = snapshotURLs
+	d.streamURLs = streamURLs
+	d.mu.Unlock()
+
+	return nil
+}
+
+func (d *OnvifDriver) SnapshotURL(stream string) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if snapshotURL, ok := d.snapshotURLs[stream]; ok {
+		return snapshotURL
+	}
+	if snapshotURL, ok := d.snapshotURLs[StreamMain]; ok {
+		return snapshotURL
+	}
+
+	return d.conf.SnapshotURL
+}
+
+func (d *OnvifDriver) StreamURL(stream string) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	streamURL, ok := d.streamURLs[stream]
+	if !ok {
+		streamURL, ok = d.streamURLs[StreamMain]
+	}
+	if !ok {
+		streamURL = d.conf.StreamURL
+	}
+	if streamURL == "" {
+		// camera is not resolved yet
+		return ""
+	}
+
+	return withCredentials(streamURL, d.conf.User, d.conf.Pass)
+}
+
+func (d *OnvifDriver) Transport() http.RoundTripper {
+	transport, _ := authTransport(d.conf.AuthScheme(AuthDigest), d.conf.User, d.conf.Pass)
+	return transport
+}
+
+func (d *OnvifDriver) Probe(checker *http.Client) bool {
+	return probeReachable(checker, d.SnapshotURL(StreamMain))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+const (
+	defaultAlertCooldown = 60
+	defaultAlertClip     = 10
+)
+
+// CameraEvent is a motion or intrusion detected either by camera itself or by the bot
+type CameraEvent struct {
+	Tag         string
+	Type        string
+	Description string
+	Time        time.Time
+}
+
+// Events delivers camera events to every user permitted to see the camera
+type Events struct {
+	app      *Application
+	mux      sync.Mutex
+	lastSent map[string]time.Time
+}
+
+func (e *Events) Setup(app *Application) {
+	e.app = app
+	e.lastSent = make(map[string]time.Time)
+}
+
+// Notify sends snapshot and short clip of the event unless camera is in cooldown
+func (e *Events) Notify(event CameraEvent) {
+	conf, err := e.app.cameras.Config(event.Tag)
+	if err != nil {
+		log.Println("Event for unknown camera", event.Tag, err)
+		return
+	}
+
+	if !e.acquire(conf, event.Time) {
+		log.Println("Event skipped due cooldown", event.Tag, event.Type)
+		return
+	}
+
+	log.Println("Camera event", event.Tag, event.Type, event.Description)
+
+	go e.deliver(conf, event)
+}
+
+func (e *Events) acquire(conf CameraConfig, now time.Time) bool {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	cooldown := time.Duration(conf.AlertCooldownSeconds()) * time.Second
+	if now.Sub(e.lastSent[conf.Tag]) < cooldown {
+		return false
+	}
+
+	e.lastSent[conf.Tag] = now
+
+	return true
+}
+
+func (e *Events) deliver(conf CameraConfig, event CameraEvent) {
+	users := e.app.permissions.GetUsersFor(conf.Tag, CapAlerts)
+	if len(users) == 0 {
+		return
+	}
+
+	caption := fmt.Sprintf("%v on %v at %v", event.Description, conf.Name, event.Time.Format(time.TimeOnly))
+
+	image, err := e.app.cameras.GetImage(conf.Tag, StreamMain)
+	if err != nil {
+		log.Println("Failed to get event snapshot", conf.Tag, err)
+	} else {
+		for _, userId := range users {
+			_, err := e.app.tgBot.SendPhoto(
+				userId,
+				gotgbot.InputFileByReader(fmt.Sprintf("%v.jpeg", conf.Tag), bytes.NewReader(image)),
+				&gotgbot.SendPhotoOpts{
+					Caption:        caption,
+					ProtectContent: true,
+				},
+			)
+			if err != nil {
+				log.Println("Failed to send event snapshot", userId, err)
+			}
+		}
+	}
+
+	filePath, err := e.app.config.GetTmpClipPath(fmt.Sprintf("%v_%v", conf.Tag, event.Time.UnixNano()))
+	if err != nil {
+		log.Println("Failed to prepare event clip path", err)
+		return
+	}
+	defer os.Remove(filePath)
+
+	err = e.recordClip(conf, event.Time, filePath)
+	if err != nil {
+		log.Println("Failed to record event clip", conf.Tag, err)
+		return
+	}
+
+	for _, userId := range users {
+		err := SendVideoFile(e.app.tgBot, userId, filePath, caption)
+		if err != nil {
+			log.Println("Failed to send event clip", userId, err)
+		}
+	}
+}
+
+// recordClip stitches pre-roll from camera buffer with live post-roll,
+// cameras without buffer record only post-roll from the live stream
+func (e *Events) recordClip(conf CameraConfig, eventTime time.Time, filePath string) error {
+	preRoll, postRoll := conf.AlertPadding()
+
+	buffer, ok := e.app.buffers.Get(conf.Tag)
+	if ok {
+		to := eventTime.Add(postRoll)
+		buffer.WaitUntil(to)
+
+		return buffer.Clip(eventTime.Add(-preRoll), to, filePath)
+	}
+
+	input, err := e.app.cameras.Stream(conf.Tag, StreamMain)
+	if err != nil {
+		return err
+	}
+
+	return RecordClip(e.app.env, input, postRoll, filePath)
+}
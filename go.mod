@@ -6,9 +6,11 @@ require (
 	github.com/PaulSonOfLars/gotgbot/v2 v2.0.0-rc.28
 	github.com/amarnathcjd/gogram v0.0.0-20240810044025-58042fbd82c5
 	github.com/icholy/digest v0.1.23
+	go.etcd.io/bbolt v1.3.11
 )
 
 require (
 	github.com/pkg/errors v0.9.1 // indirect
 	golang.org/x/net v0.28.0 // indirect
+	golang.org/x/sys v0.23.0 // indirect
 )
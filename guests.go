@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	// inviteTTL is how long invite link can be redeemed
+	inviteTTL           = time.Hour * 24 * 7
+	guestExpiryInterval = time.Minute
+)
+
+type Invite struct {
+	Tags     []string      `json:"tags"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Guest is time limited access granted by redeemed invite
+type Guest struct {
+	UserId    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	Tags      []string  `json:"tags"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (g Guest) String() string {
+	return fmt.Sprintf("{UserId: %v, Tags: %v, ExpiresAt: %v}", g.UserId, g.Tags, g.ExpiresAt.Format(time.DateTime))
+}
+
+// CreateInvite stores one time invite and returns its token
+func (p *Permissions) CreateInvite(tags []string, duration time.Duration) (string, error) {
+	err := p.validateTags(tags)
+	if err != nil {
+		return "", err
+	}
+
+	raw := make([]byte, 16)
+	_, err = rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+
+	err = p.store.Put(bucketInvites, token, Invite{tags, duration}, inviteTTL)
+	if err != nil {
+		return "", fmt.Errorf("failed to save invite: %w", err)
+	}
+
+	return token, nil
+}
+
+// RedeemInvite turns invite into guest access of the user, invite can be used only once.
+// Active guest access of the user is extended with invite tags and keeps the later expiry.
+func (p *Permissions) RedeemInvite(token string, userId int64, username string) (Guest, bool, error) {
+	guest := Guest{}
+	found := false
+
+	err := p.store.Update(func(tx StoreTx) error {
+		invite := Invite{}
+		ok, err := tx.Get(bucketInvites, token, &invite)
+		if err != nil || !ok {
+			return err
+		}
+
+		err = tx.Delete(bucketInvites, token)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		key := strconv.FormatInt(userId, 10)
+
+		guest = Guest{
+			UserId:    userId,
+			Username:  username,
+			Tags:      slices.Clone(invite.Tags),
+			ExpiresAt: now.Add(invite.Duration),
+		}
+
+		existing := Guest{}
+		ok, err = tx.Get(bucketGuests, key, &existing)
+		if err != nil {
+			return err
+		}
+
+		if ok && now.Before(existing.ExpiresAt) {
+			for _, tag := range existing.Tags {
+				if !slices.Contains(guest.Tags, tag) {
+					guest.Tags = append(guest.Tags, tag)
+				}
+			}
+
+			if existing.ExpiresAt.After(guest.ExpiresAt) {
+				guest.ExpiresAt = existing.ExpiresAt
+			}
+		}
+
+		found = true
+
+		return tx.Put(bucketGuests, key, guest, 0)
+	})
+	if err != nil {
+		return Guest{}, false, fmt.Errorf("failed to redeem invite: %w", err)
+	}
+
+	return guest, found, nil
+}
+
+func (p *Permissions) getGuest(userId int64) (Guest, bool) {
+	guest := Guest{}
+	ok, err := p.store.Get(bucketGuests, strconv.FormatInt(userId, 10), &guest)
+	if err != nil {
+		log.Println("Failed to get guest", userId, err)
+		return Guest{}, false
+	}
+
+	if !ok || !time.Now().Before(guest.ExpiresAt) {
+		return Guest{}, false
+	}
+
+	return guest, true
+}
+
+func (p *Permissions) removeGuest(userId int64) error {
+	return p.store.Delete(bucketGuests, strconv.FormatInt(userId, 10))
+}
+
+// removeExpiredGuest removes guest access of the user when it is still expired at the moment of removal,
+// so access extended by invite redeemed in between is kept
+func (p *Permissions) removeExpiredGuest(userId int64, now time.Time) (Guest, bool, error) {
+	guest := Guest{}
+	removed := false
+
+	err := p.store.Update(func(tx StoreTx) error {
+		key := strconv.FormatInt(userId, 10)
+
+		ok, err := tx.Get(bucketGuests, key, &guest)
+		if err != nil || !ok || now.Before(guest.ExpiresAt) {
+			return err
+		}
+
+		removed = true
+
+		return tx.Delete(bucketGuests, key)
+	})
+
+	return guest, removed, err
+}
+
+// revokeGuestTags removes tags from guest access of the user, guest without tags is removed
+func (p *Permissions) revokeGuestTags(userId int64, tags []string) error {
+	return p.store.Update(func(tx StoreTx) error {
+		key := strconv.FormatInt(userId, 10)
+
+		guest := Guest{}
+		ok, err := tx.Get(bucketGuests, key, &guest)
+		if err != nil || !ok {
+			return err
+		}
+
+		guest.Tags = slices.DeleteFunc(guest.Tags, func(tag string) bool {
+			return slices.Contains(tags, tag)
+		})
+		if len(guest.Tags) == 0 {
+			return tx.Delete(bucketGuests, key)
+		}
+
+		return tx.Put(bucketGuests, key, guest, 0)
+	})
+}
+
+func (p *Permissions) guests() []Guest {
+	guests := make([]Guest, 0)
+
+	err := p.store.Scan(bucketGuests, "", func(key string, raw json.RawMessage) bool {
+		guest := Guest{}
+		if json.Unmarshal(raw, &guest) == nil {
+			guests = append(guests, guest)
+		}
+
+		return true
+	})
+	if err != nil {
+		log.Println("Failed to scan guests", err)
+	}
+
+	return guests
+}
+
+// withGuest extends permissions with active guest access of the same user
+func (p *Permissions) withGuest(permissions *CameraPermissions, userId int64) *CameraPermissions {
+	guest, ok := p.getGuest(userId)
+	if !ok {
+		return permissions
+	}
+
+	if permissions == nil {
+		return &CameraPermissions{UserId: userId, Tags: slices.Clone(guest.Tags)}
+	}
+
+	merged := *permissions
+	merged.Tags = slices.Clone(permissions.Tags)
+	for _, tag := range guest.Tags {
+		if !slices.Contains(merged.Tags, tag) {
+			merged.Tags = append(merged.Tags, tag)
+		}
+	}
+
+	return &merged
+}
+
+// StartGuestExpiry removes expired guests calling onExpire for each of them
+func (p *Permissions) StartGuestExpiry(onExpire func(guest Guest)) {
+	go func() {
+		ticker := time.NewTicker(guestExpiryInterval)
+		defer ticker.Stop()
+
+		for now := range ticker.C {
+			for _, guest := range p.guests() {
+				if now.Before(guest.ExpiresAt) {
+					continue
+				}
+
+				expired, removed, err := p.removeExpiredGuest(guest.UserId, now)
+				if err != nil {
+					log.Println("Failed to remove expired guest", guest.UserId, err)
+					continue
+				}
+
+				if removed {
+					onExpire(expired)
+				}
+			}
+		}
+	}()
+}
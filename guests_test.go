@@ -0,0 +1,40 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRemoveExpiredGuest(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "state.db"))
+	defer store.Close()
+
+	permissions := Permissions{store: store}
+	now := time.Now()
+
+	err := store.Put(bucketGuests, "1", Guest{UserId: 1, Tags: []string{"yard"}, ExpiresAt: now.Add(-time.Minute)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// guest 2 redeemed new invite after expiry scan
+	err = store.Put(bucketGuests, "2", Guest{UserId: 2, Tags: []string{"yard"}, ExpiresAt: now.Add(time.Hour)}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guest, removed, err := permissions.removeExpiredGuest(1, now)
+	if err != nil || !removed || guest.UserId != 1 {
+		t.Errorf("removeExpiredGuest(1) = %v, %v, %v, want removed guest 1", guest, removed, err)
+	}
+
+	_, removed, err = permissions.removeExpiredGuest(2, now)
+	if err != nil || removed {
+		t.Errorf("removeExpiredGuest(2) = %v, %v, want kept", removed, err)
+	}
+
+	if _, ok := permissions.getGuest(2); !ok {
+		t.Error("extended guest is removed")
+	}
+}
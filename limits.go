@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+const quotaTTL = time.Hour * 48
+
+type BucketConfig struct {
+	// Burst is amount of actions allowed at once
+	Burst int `json:"burst"`
+	// Every is seconds needed to regain one action
+	Every int `json:"every"`
+}
+
+type LimitsConfig struct {
+	// Buckets maps bucket name attached to handlers (snapshot, record, ptz, call, timelapse) to its rate
+	Buckets map[string]BucketConfig `json:"buckets"`
+	// MaxConcurrentRecordings per camera, unlimited when 0
+	MaxConcurrentRecordings int `json:"max_concurrent_recordings"`
+	// DailyRecordingMinutes per user, unlimited when 0
+	DailyRecordingMinutes int `json:"daily_recording_minutes"`
+}
+
+// LimitError is returned when action is rejected by limiter, RetryAfter is a hint for the user
+type LimitError struct {
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v, try again in %v seconds", e.Reason, int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter keeps token buckets per user and bucket name, active recordings per camera
+// and daily recording usage per user. Usage is persisted so restarts do not reset quotas.
+type Limiter struct {
+	config *LimitsConfig
+	store  Store
+
+	mu         sync.Mutex
+	buckets    map[string]*tokenBucket
+	recordings map[string][]time.Time
+}
+
+func (l *Limiter) Setup(config *LimitsConfig, store Store) {
+	l.config = config
+	l.store = store
+	l.buckets = make(map[string]*tokenBucket)
+	l.recordings = make(map[string][]time.Time)
+}
+
+// Allow takes token from bucket of the user, unknown buckets are unlimited
+func (l *Limiter) Allow(userId int64, bucket string) error {
+	conf, ok := l.config.Buckets[bucket]
+	if !ok || conf.Burst <= 0 || conf.Every <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	every := time.Duration(conf.Every) * time.Second
+	key := fmt.Sprintf("%v/%v", userId, bucket)
+
+	state, ok := l.buckets[key]
+	if !ok {
+		state = &tokenBucket{float64(conf.Burst), now}
+		l.buckets[key] = state
+	}
+
+	state.tokens = min(float64(conf.Burst), state.tokens+float64(now.Sub(state.updated))/float64(every))
+	state.updated = now
+
+	if state.tokens < 1 {
+		return &LimitError{
+			Reason:     "Too many requests",
+			RetryAfter: time.Duration((1 - state.tokens) * float64(every)),
+		}
+	}
+
+	state.tokens--
+
+	return nil
+}
+
+// StartRecording reserves recording slot on camera and daily minutes of the user,
+// returned release must be called with recording result once it is finished, minutes are refunded on error
+func (l *Limiter) StartRecording(userId int64, tag string, duration time.Duration) (func(err error), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+
+	active := l.recordings[tag][:0]
+	for _, end := range l.recordings[tag] {
+		if end.After(now) {
+			active = append(active, end)
+		}
+	}
+	l.recordings[tag] = active
+
+	if l.config.MaxConcurrentRecordings > 0 && len(active) >= l.config.MaxConcurrentRecordings {
+		earliest := active[0]
+		for _, end := range active {
+			if end.Before(earliest) {
+				earliest = end
+			}
+		}
+
+		return nil, &LimitError{
+			Reason:     fmt.Sprintf("Camera %v is busy with other recordings", tag),
+			RetryAfter: earliest.Sub(now),
+		}
+	}
+
+	used := l.usage(userId, now)
+	if limit := time.Duration(l.config.DailyRecordingMinutes) * time.Minute; limit > 0 && used+duration > limit {
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.Local)
+
+		return nil, &LimitError{
+			Reason:     fmt.Sprintf("Daily recording quota of %v minutes is used", l.config.DailyRecordingMinutes),
+			RetryAfter: tomorrow.Sub(now),
+		}
+	}
+
+	err := l.store.Put(bucketQuotas, quotaKey(userId, now), int64(used+duration), quotaTTL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save recording quota: %w", err)
+	}
+
+	// slot is held until release or until recording is expected to end
+	end := now.Add(duration + time.Minute)
+	l.recordings[tag] = append(l.recordings[tag], end)
+
+	released := false
+	release := func(err error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if released {
+			return
+		}
+		released = true
+
+		for i, active := range l.recordings[tag] {
+			if active.Equal(end) {
+				l.recordings[tag] = append(l.recordings[tag][:i], l.recordings[tag][i+1:]...)
+				break
+			}
+		}
+
+		if err != nil {
+			l.refund(userId, now, duration)
+		}
+	}
+
+	return release, nil
+}
+
+// refund returns minutes of failed recording to usage of the day it was started
+func (l *Limiter) refund(userId int64, started time.Time, duration time.Duration) {
+	used := max(0, l.usage(userId, started)-duration)
+
+	err := l.store.Put(bucketQuotas, quotaKey(userId, started), int64(used), quotaTTL)
+	if err != nil {
+		log.Println("Failed to refund recording quota", userId, err)
+	}
+}
+
+// Reset drops rate limit state and today recording usage of the user
+func (l *Limiter) Reset(userId int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for bucket := range l.config.Buckets {
+		delete(l.buckets, fmt.Sprintf("%v/%v", userId, bucket))
+	}
+
+	return l.store.Delete(bucketQuotas, quotaKey(userId, time.Now()))
+}
+
+// Usage returns recording time used by the user today
+func (l *Limiter) Usage(userId int64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.usage(userId, time.Now())
+}
+
+func (l *Limiter) usage(userId int64, now time.Time) time.Duration {
+	var used int64
+	_, err := l.store.Get(bucketQuotas, quotaKey(userId, now), &used)
+	if err != nil {
+		return 0
+	}
+
+	return time.Duration(used)
+}
+
+func quotaKey(userId int64, now time.Time) string {
+	return strconv.FormatInt(userId, 10) + "/" + now.Format(time.DateOnly)
+}
+
+// exempt reports whether user bypasses limits: admins and users marked unlimited
+func (app *Application) exempt(userId int64, permissions *CameraPermissions) bool {
+	return app.IsAdmin(userId) || (permissions != nil && permissions.Unlimited)
+}
+
+// limit takes token of requirement bucket unless user is exempt
+func (app *Application) limit(userId int64, permissions *CameraPermissions, requirement Requirement) error {
+	if requirement.Bucket == "" || app.exempt(userId, permissions) {
+		return nil
+	}
+
+	return app.limiter.Allow(userId, requirement.Bucket)
+}
+
+// startRecording applies recording limits unless user is exempt
+func (c *HandlerContext) startRecording(tag string, duration time.Duration) (func(err error), error) {
+	userId := c.ctx.EffectiveUser.Id
+	if c.app.exempt(userId, c.app.permissions.GetPermissionsFor(userId)) {
+		return func(err error) {}, nil
+	}
+
+	return c.app.limiter.StartRecording(userId, tag, duration)
+}
+
+// replyLimit tells user why action is rejected, error is returned so it lands in audit log
+func (c *HandlerContext) replyLimit(err error) error {
+	if limitErr := (*LimitError)(nil); !errors.As(err, &limitErr) {
+		return err
+	}
+
+	_, sendErr := c.bot.SendMessage(c.ctx.EffectiveChat.Id, err.Error(), &gotgbot.SendMessageOpts{})
+	if sendErr != nil {
+		log.Println("Failed to send limit reply", sendErr)
+	}
+
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLimiterRecordingQuota(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "state.db"))
+	defer store.Close()
+
+	limiter := Limiter{}
+	limiter.Setup(&LimitsConfig{DailyRecordingMinutes: 2}, store)
+
+	release, err := limiter.StartRecording(1, "yard", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(errors.New("recording failed"))
+	release(nil)
+
+	if used := limiter.Usage(1); used != 0 {
+		t.Errorf("Usage after failed recording = %v, want 0", used)
+	}
+
+	for range 2 {
+		release, err := limiter.StartRecording(1, "yard", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		release(nil)
+	}
+
+	if used := limiter.Usage(1); used != 2*time.Minute {
+		t.Errorf("Usage = %v, want 2m", used)
+	}
+
+	_, err = limiter.StartRecording(1, "yard", time.Minute)
+	if limitErr := (*LimitError)(nil); !errors.As(err, &limitErr) {
+		t.Errorf("StartRecording over quota error = %v, want limit error", err)
+	}
+}
@@ -18,20 +18,50 @@ func main() {
 		fmt.Println("App initialized\nConfig:", app.config)
 	}
 
-	app.AddCommand("start", StartCmd)
-	app.AddCommand("about", AboutCmd)
-	app.AddCommand("all", AllCmd)
-	app.AddCommand("call", CallCmd)
-	app.AddCommand("record", RecordCmd)
-
-	for _, cameraConfig := range app.config.Cameras {
-		callback := prepareCallbackHood(cameraConfig.Tag)
-		app.AddCallback(callback, RecordTagCallbackFactory(cameraConfig))
-	}
+	app.AddPublicCommand("start", StartCmd)
+	app.AddCommand("about", Requirement{}, AboutCmd)
+	app.AddCommand("all", Requires(CapSnapshot).Limited("snapshot"), AllCmd)
+	app.AddCommand("call", Requires(CapCall), CallCmd)
+	app.AddCommand("hangup", Requirement{}, HangupCmd)
+	app.AddCommand("record", Requires(CapRecord), RecordCmd)
+	app.AddCommand("rewind", Requires(CapRecord), RewindCmd)
+	app.AddCommand("playback", Requires(CapRecord), PlaybackCmd)
+	app.AddCommand("ptz", Requires(CapPtz), PtzCmd)
+	app.AddCommand("timelapse", Requires(CapSnapshot).Limited("timelapse"), TimelapseCmd)
 
-	for _, timeRange := range TimeRanges {
-		app.AddCallback(prepareCallbackHood(timeRange), RecordTimeCallbackFactory(timeRange))
-	}
+	app.AddAdminCommand("grant", GrantCmd)
+	app.AddAdminCommand("revoke", RevokeCmd)
+	app.AddAdminCommand("users", UsersCmd)
+	app.AddAdminCommand("invite", InviteCmd)
+	app.AddAdminCommand("role", RoleCmd)
+	app.AddAdminCommand("audit", AuditCmd)
+	app.AddAdminCommand("limits", LimitsCmd)
+	app.AddAdminCommand("calls", CallsCmd)
+
+	app.AddCallbackAction(actionAccessTag, Requires(CapAdmin), AccessTagCallback)
+	app.AddCallbackAction(actionAccessApprove, Requires(CapAdmin), AccessApproveCallback)
+	app.AddCallbackAction(actionAccessDeny, Requires(CapAdmin), AccessDenyCallback)
+
+	app.AddCallbackAction(actionRecordCamera, Requires(CapRecord), RecordCameraCallback)
+	app.AddCallbackAction(actionRecordStream, Requires(CapRecord), RecordStreamCallback)
+	app.AddCallbackAction(actionRecordTime, Requires(CapRecord).Limited("record"), RecordTimeCallback)
+
+	app.AddCallbackAction(actionRewindCamera, Requires(CapRecord), RewindCameraCallback)
+	app.AddCallbackAction(actionRewindTime, Requires(CapRecord).Limited("record"), RewindTimeCallback)
+
+	app.AddCallbackAction(actionPlaybackCamera, Requires(CapRecord), PlaybackCameraCallback)
+	app.AddCallbackAction(actionPlaybackDay, Requires(CapRecord), PlaybackDayCallback)
+	app.AddCallbackAction(actionPlaybackHour, Requires(CapRecord), PlaybackHourCallback)
+	app.AddCallbackAction(actionPlaybackMinute, Requires(CapRecord).Limited("record"), PlaybackMinuteCallback)
+
+	app.AddCallbackAction(actionPtzMove, Requires(CapPtz).Limited("ptz"), PtzMoveCallback)
+	app.AddCallbackAction(actionPtzPreset, Requires(CapPtz).Limited("ptz"), PtzPresetCallback)
+
+	app.AddCallbackAction(actionCallCamera, Requires(CapCall).Limited("call"), CallCameraCallback)
+	app.AddCallbackAction(actionCallSwitch, Requires(CapCall), CallSwitchCallback)
+	app.AddCallbackAction(actionCallHangup, Requirement{}, CallHangupCallback)
+	app.AddCallbackAction(actionCallMute, Requirement{}, CallMuteCallback)
+	app.AddCallbackAction(actionCallUnmute, Requirement{}, CallUnmuteCallback)
 
 	err = app.Start()
 	if err != nil {
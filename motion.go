@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"log"
+	"math"
+	"time"
+)
+
+const (
+	motionFrameWidth  = 64
+	motionFrameHeight = 48
+	// motionLearningRate is how fast background adapts to the scene changes
+	motionLearningRate = 0.1
+
+	defaultMotionInterval    = 2
+	defaultMotionSensitivity = 50
+	defaultMotionMinArea     = 1.0
+	defaultMotionMaxArea     = 90.0
+)
+
+// MotionZone is a rectangle in fractions of frame size, e.g. {0, 0, 0.5, 0.1} is top left half stripe
+type MotionZone struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+func (z MotionZone) Contains(x, y float64) bool {
+	return x >= z.X && x < z.X+z.Width && y >= z.Y && y < z.Y+z.Height
+}
+
+type MotionConfig struct {
+	Enabled bool `json:"enabled"`
+	// Interval between snapshots in seconds
+	Interval int `json:"interval"`
+	// Sensitivity from 1 to 100, higher value reacts on smaller brightness changes
+	Sensitivity int `json:"sensitivity"`
+	// MinArea is percent of frame which has to change to raise event
+	MinArea float64 `json:"min_area"`
+	// MaxArea is percent of frame above which change is treated as lighting switch and ignored
+	MaxArea float64      `json:"max_area"`
+	Exclude []MotionZone `json:"exclude"`
+}
+
+func (m MotionConfig) IntervalDuration() time.Duration {
+	if m.Interval == 0 {
+		return defaultMotionInterval * time.Second
+	}
+
+	return time.Duration(m.Interval) * time.Second
+}
+
+// Threshold returns minimal per pixel brightness difference counted as changed
+func (m MotionConfig) Threshold() float32 {
+	sensitivity := m.Sensitivity
+	if sensitivity == 0 {
+		sensitivity = defaultMotionSensitivity
+	}
+	sensitivity = max(1, min(sensitivity, 100))
+
+	return float32(255*(101-sensitivity)) / 200
+}
+
+func (m MotionConfig) Area() (float64, float64) {
+	minArea := m.MinArea
+	if minArea == 0 {
+		minArea = defaultMotionMinArea
+	}
+
+	maxArea := m.MaxArea
+	if maxArea == 0 {
+		maxArea = defaultMotionMaxArea
+	}
+
+	return minArea, maxArea
+}
+
+// MotionDetectors pulls snapshots of cameras without camera side events and compares them
+// against rolling background, detected motion goes to the same notify path as ISAPI alerts
+type MotionDetectors struct {
+	cameras *Cameras
+	notify  func(event CameraEvent)
+	configs []CameraConfig
+}
+
+func (md *MotionDetectors) Setup(cameras *Cameras, configs []CameraConfig, notify func(event CameraEvent)) {
+	md.cameras = cameras
+	md.notify = notify
+	md.configs = make([]CameraConfig, 0)
+
+	for _, conf := range configs {
+		if conf.Motion.Enabled {
+			md.configs = append(md.configs, conf)
+		}
+	}
+}
+
+func (md *MotionDetectors) Start() {
+	for _, conf := range md.configs {
+		go md.watch(conf)
+	}
+}
+
+func (md *MotionDetectors) watch(conf CameraConfig) {
+	detector := NewMotionDetector(conf.Motion)
+
+	ticker := time.NewTicker(conf.Motion.IntervalDuration())
+	defer ticker.Stop()
+
+	for range ticker.C {
+		images := md.cameras.GetAllImages([]string{conf.Tag}, StreamSub)
+		data, ok := images[conf.Tag]
+		if !ok {
+			continue
+		}
+
+		frame, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			log.Println("Failed to decode motion frame", conf.Tag, err)
+			continue
+		}
+
+		if detector.Detect(frame) {
+			md.notify(CameraEvent{
+				Tag:         conf.Tag,
+				Type:        "motion",
+				Description: "Motion",
+				Time:        time.Now(),
+			})
+		}
+	}
+}
+
+type MotionDetector struct {
+	conf       MotionConfig
+	background []float32
+	mask       []bool
+}
+
+func NewMotionDetector(conf MotionConfig) *MotionDetector {
+	mask := make([]bool, motionFrameWidth*motionFrameHeight)
+	for y := range motionFrameHeight {
+		for x := range motionFrameWidth {
+			cx := (float64(x) + 0.5) / motionFrameWidth
+			cy := (float64(y) + 0.5) / motionFrameHeight
+
+			excluded := false
+			for _, zone := range conf.Exclude {
+				if zone.Contains(cx, cy) {
+					excluded = true
+					break
+				}
+			}
+
+			mask[y*motionFrameWidth+x] = !excluded
+		}
+	}
+
+	return &MotionDetector{
+		conf: conf,
+		mask: mask,
+	}
+}
+
+// Detect compares frame with background and updates background with the frame
+func (d *MotionDetector) Detect(frame image.Image) bool {
+	gray := downscaleGray(frame)
+
+	if d.background == nil {
+		d.background = gray
+		return false
+	}
+
+	threshold := d.conf.Threshold()
+	changed, total := 0, 0
+	for i, value := range gray {
+		if d.mask[i] {
+			total++
+			if float32(math.Abs(float64(value-d.background[i]))) > threshold {
+				changed++
+			}
+		}
+
+		d.background[i] += (value - d.background[i]) * motionLearningRate
+	}
+
+	if total == 0 {
+		return false
+	}
+
+	minArea, maxArea := d.conf.Area()
+	area := float64(changed) * 100 / float64(total)
+
+	return area >= minArea && area <= maxArea
+}
+
+// downscaleGray converts frame to small grayscale one averaging source pixels of every cell
+func downscaleGray(frame image.Image) []float32 {
+	bounds := frame.Bounds()
+	gray := make([]float32, motionFrameWidth*motionFrameHeight)
+
+	for y := range motionFrameHeight {
+		y0 := bounds.Min.Y + y*bounds.Dy()/motionFrameHeight
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/motionFrameHeight)
+
+		for x := range motionFrameWidth {
+			x0 := bounds.Min.X + x*bounds.Dx()/motionFrameWidth
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/motionFrameWidth)
+
+			// sampling every pixel of 1080p frame is too slow, 4x4 grid per cell is enough
+			stepX := max(1, (x1-x0)/4)
+			stepY := max(1, (y1-y0)/4)
+
+			var sum float32
+			count := 0
+			for sy := y0; sy < y1; sy += stepY {
+				for sx := x0; sx < x1; sx += stepX {
+					r, g, b, _ := frame.At(sx, sy).RGBA()
+					sum += float32(19595*r+38470*g+7471*b+1<<15) / float32(1<<24)
+					count++
+				}
+			}
+
+			gray[y*motionFrameWidth+x] = sum / float32(count)
+		}
+	}
+
+	return gray
+}
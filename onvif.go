@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	onvifDeviceNamespace = "http://www.onvif.org/ver10/device/wsdl"
+	onvifMediaNamespace  = "http://www.onvif.org/ver10/media/wsdl"
+)
+
+// OnvifClient is a minimal SOAP client for ONVIF device and media services.
+// Only what is needed to resolve Profile S snapshot and stream URIs is implemented.
+type OnvifClient struct {
+	deviceURL string
+	user      string
+	pass      string
+	client    *http.Client
+}
+
+func NewOnvifClient(deviceURL, user, pass string, client *http.Client) *OnvifClient {
+	return &OnvifClient{
+		deviceURL,
+		user,
+		pass,
+		client,
+	}
+}
+
+type onvifEnvelope struct {
+	Body struct {
+		Inner []byte `xml:",innerxml"`
+		Fault *struct {
+			Reason string `xml:"Reason>Text"`
+		} `xml:"Fault"`
+	} `xml:"Body"`
+}
+
+type onvifCapabilitiesResponse struct {
+	MediaXAddr string `xml:"GetCapabilitiesResponse>Capabilities>Media>XAddr"`
+}
+
+type onvifProfilesResponse struct {
+	Profiles []struct {
+		Token string `xml:"token,attr"`
+		Name  string `xml:"Name"`
+	} `xml:"GetProfilesResponse>Profiles"`
+}
+
+type onvifMediaUriResponse struct {
+	SnapshotUri string `xml:"GetSnapshotUriResponse>MediaUri>Uri"`
+	StreamUri   string `xml:"GetStreamUriResponse>MediaUri>Uri"`
+}
+
+// MediaURL returns media service address reported by device, falling back to device address itself
+func (oc *OnvifClient) MediaURL() (string, error) {
+	res := onvifCapabilitiesResponse{}
+	err := oc.call(
+		oc.deviceURL,
+		fmt.Sprintf(`<GetCapabilities xmlns="%v"><Category>Media</Category></GetCapabilities>`, onvifDeviceNamespace),
+		&res,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to get onvif capabilities: %w", err)
+	}
+
+	if res.MediaXAddr == "" {
+		return oc.deviceURL, nil
+	}
+
+	return oc.rebase(res.MediaXAddr), nil
+}
+
+// GetProfiles returns media profile tokens in device order
+func (oc *OnvifClient) GetProfiles(mediaURL string) ([]string, error) {
+	res := onvifProfilesResponse{}
+	err := oc.call(mediaURL, fmt.Sprintf(`<GetProfiles xmlns="%v"/>`, onvifMediaNamespace), &res)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get onvif profiles: %w", err)
+	}
+
+	tokens := make([]string, 0, len(res.Profiles))
+	for _, profile := range res.Profiles {
+		tokens = append(tokens, profile.Token)
+	}
+
+	return tokens, nil
+}
+
+func (oc *OnvifClient) GetSnapshotUri(mediaURL, profileToken string) (string, error) {
+	res := onvifMediaUriResponse{}
+	err := oc.call(
+		mediaURL,
+		fmt.Sprintf(`<GetSnapshotUri xmlns="%v"><ProfileToken>%v</ProfileToken></GetSnapshotUri>`, onvifMediaNamespace, xmlEscape(profileToken)),
+		&res,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to get onvif snapshot uri: %w", err)
+	}
+
+	return oc.rebase(res.SnapshotUri), nil
+}
+
+func (oc *OnvifClient) GetStreamUri(mediaURL, profileToken string) (string, error) {
+	res := onvifMediaUriResponse{}
+	err := oc.call(
+		mediaURL,
+		fmt.Sprintf(
+			`<GetStreamUri xmlns="%v"><StreamSetup><Stream xmlns="http://www.onvif.org/ver10/schema">RTP-Unicast</Stream><Transport xmlns="http://www.onvif.org/ver10/schema"><Protocol>RTSP</Protocol></Transport></StreamSetup><ProfileToken>%v</ProfileToken></GetStreamUri>`,
+			onvifMediaNamespace,
+			xmlEscape(profileToken),
+		),
+		&res,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to get onvif stream uri: %w", err)
+	}
+
+	return oc.rebaseHostname(res.StreamUri), nil
+}
+
+func (oc *OnvifClient) call(endpoint, body string, out any) error {
+	envelope := fmt.Sprintf(
+		`<?xml version="1.0" encoding="UTF-8"?><s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Header>%v</s:Header><s:Body>%v</s:Body></s:Envelope>`,
+		oc.securityHeader(time.Now()),
+		body,
+	)
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewBufferString(envelope))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
+
+	res, err := oc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	parsed := onvifEnvelope{}
+	err = xml.Unmarshal(data, &parsed)
+	if err != nil {
+		return fmt.Errorf("failed to parse soap response (status %v): %w", res.StatusCode, err)
+	}
+
+	if parsed.Body.Fault != nil {
+		return fmt.Errorf("soap fault: %v", parsed.Body.Fault.Reason)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected soap response status: %v", res.StatusCode)
+	}
+
+	return xml.Unmarshal(wrapInner(parsed.Body.Inner), out)
+}
+
+// securityHeader builds WS-Security UsernameToken with PasswordDigest
+func (oc *OnvifClient) securityHeader(now time.Time) string {
+	if oc.user == "" {
+		return ""
+	}
+
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	created := now.UTC().Format(time.RFC3339)
+
+	hasher := sha1.New()
+	hasher.Write(nonce)
+	hasher.Write([]byte(created))
+	hasher.Write([]byte(oc.pass))
+	digest := base64.StdEncoding.EncodeToString(hasher.Sum(nil))
+
+	return fmt.Sprintf(
+		`<Security s:mustUnderstand="1" xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"><UsernameToken><Username>%v</Username><Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">%v</Password><Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">%v</Nonce><Created xmlns="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">%v</Created></UsernameToken></Security>`,
+		xmlEscape(oc.user),
+		digest,
+		base64.StdEncoding.EncodeToString(nonce),
+		created,
+	)
+}
+
+// rebase replaces host of device reported address with the configured one,
+// cameras behind NAT or port forwarding often report their internal address
+func (oc *OnvifClient) rebase(rawURL string) string {
+	reported, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	configured, err := url.Parse(oc.deviceURL)
+	if err != nil {
+		return rawURL
+	}
+
+	reported.Scheme = configured.Scheme
+	reported.Host = configured.Host
+
+	return reported.String()
+}
+
+// rebaseHostname replaces only hostname keeping reported scheme and port, used for RTSP URIs
+func (oc *OnvifClient) rebaseHostname(rawURL string) string {
+	reported, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	configured, err := url.Parse(oc.deviceURL)
+	if err != nil {
+		return rawURL
+	}
+
+	if port := reported.Port(); port != "" {
+		reported.Host = fmt.Sprintf("%v:%v", configured.Hostname(), port)
+	} else {
+		reported.Host = configured.Hostname()
+	}
+
+	return reported.String()
+}
+
+func wrapInner(inner []byte) []byte {
+	return append(append([]byte("<body>"), inner...), []byte("</body>")...)
+}
+
+func xmlEscape(value string) string {
+	buffer := bytes.Buffer{}
+	_ = xml.EscapeText(&buffer, []byte(value))
+
+	return buffer.String()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type onvifTestRequest struct {
+	Header struct {
+		Username string `xml:"Security>UsernameToken>Username"`
+		Password string `xml:"Security>UsernameToken>Password"`
+		Nonce    string `xml:"Security>UsernameToken>Nonce"`
+		Created  string `xml:"Security>UsernameToken>Created"`
+	} `xml:"Header"`
+	Body struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"Body"`
+}
+
+func onvifTestEnvelope(body string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?><s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope"><s:Body>%v</s:Body></s:Envelope>`, body)
+}
+
+// newOnvifTestServer stands in for camera media service, requests with wrong credentials get SOAP fault
+func newOnvifTestServer(t *testing.T, user, pass string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("failed to read request: %v", err)
+			return
+		}
+
+		req := onvifTestRequest{}
+		err = xml.Unmarshal(data, &req)
+		if err != nil {
+			t.Errorf("failed to parse request: %v", err)
+			return
+		}
+
+		nonce, _ := base64.StdEncoding.DecodeString(req.Header.Nonce)
+		hasher := sha1.New()
+		hasher.Write(nonce)
+		hasher.Write([]byte(req.Header.Created))
+		hasher.Write([]byte(pass))
+		digest := base64.StdEncoding.EncodeToString(hasher.Sum(nil))
+
+		if req.Header.Username != user || req.Header.Password != digest || req.Header.Created == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, onvifTestEnvelope(`<s:Fault><s:Reason><s:Text xml:lang="en">Sender not Authorized</s:Text></s:Reason></s:Fault>`))
+			return
+		}
+
+		body := req.Body.Inner
+		switch {
+		case strings.Contains(body, "<GetProfiles"):
+			io.WriteString(w, onvifTestEnvelope(`<trt:GetProfilesResponse xmlns:trt="http://www.onvif.org/ver10/media/wsdl"><trt:Profiles token="main"><tt:Name xmlns:tt="http://www.onvif.org/ver10/schema">Main</tt:Name></trt:Profiles><trt:Profiles token="sub"><tt:Name xmlns:tt="http://www.onvif.org/ver10/schema">Sub</tt:Name></trt:Profiles></trt:GetProfilesResponse>`))
+		case strings.Contains(body, "<GetSnapshotUri"):
+			io.WriteString(w, onvifTestEnvelope(`<trt:GetSnapshotUriResponse xmlns:trt="http://www.onvif.org/ver10/media/wsdl"><trt:MediaUri><tt:Uri xmlns:tt="http://www.onvif.org/ver10/schema">http://192.168.0.10/snapshot?profile=main</tt:Uri></trt:MediaUri></trt:GetSnapshotUriResponse>`))
+		case strings.Contains(body, "<GetStreamUri"):
+			io.WriteString(w, onvifTestEnvelope(`<trt:GetStreamUriResponse xmlns:trt="http://www.onvif.org/ver10/media/wsdl"><trt:MediaUri><tt:Uri xmlns:tt="http://www.onvif.org/ver10/schema">rtsp://192.168.0.10:554/main</tt:Uri></trt:MediaUri></trt:GetStreamUriResponse>`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, onvifTestEnvelope(`<s:Fault><s:Reason><s:Text xml:lang="en">Unknown action</s:Text></s:Reason></s:Fault>`))
+		}
+	}))
+}
+
+func TestOnvifClient(t *testing.T) {
+	server := newOnvifTestServer(t, "admin", "secret")
+	defer server.Close()
+
+	client := NewOnvifClient(server.URL+"/onvif/device_service", "admin", "secret", server.Client())
+	mediaURL := server.URL + "/onvif/media_service"
+
+	profiles, err := client.GetProfiles(mediaURL)
+	if err != nil {
+		t.Fatalf("GetProfiles: %v", err)
+	}
+	if strings.Join(profiles, ",") != "main,sub" {
+		t.Errorf("GetProfiles = %v, want [main sub]", profiles)
+	}
+
+	snapshotURL, err := client.GetSnapshotUri(mediaURL, "main")
+	if err != nil {
+		t.Fatalf("GetSnapshotUri: %v", err)
+	}
+	if want := server.URL + "/snapshot?profile=main"; snapshotURL != want {
+		t.Errorf("GetSnapshotUri = %v, want %v", snapshotURL, want)
+	}
+
+	streamURL, err := client.GetStreamUri(mediaURL, "main")
+	if err != nil {
+		t.Fatalf("GetStreamUri: %v", err)
+	}
+	if want := "rtsp://127.0.0.1:554/main"; streamURL != want {
+		t.Errorf("GetStreamUri = %v, want %v", streamURL, want)
+	}
+}
+
+func TestOnvifClientFault(t *testing.T) {
+	server := newOnvifTestServer(t, "admin", "secret")
+	defer server.Close()
+
+	client := NewOnvifClient(server.URL+"/onvif/device_service", "admin", "wrong", server.Client())
+
+	_, err := client.GetProfiles(server.URL + "/onvif/media_service")
+	if err == nil || !strings.Contains(err.Error(), "Sender not Authorized") {
+		t.Errorf("GetProfiles error = %v, want soap fault", err)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+)
+
+// Permissions combines permissions from config file with ones granted at runtime.
+// Runtime entry of a user fully replaces config entry of the same user.
+type Permissions struct {
+	config *Config
+	store  Store
+}
+
+func (p *Permissions) Setup(config *Config, store Store) {
+	p.config = config
+	p.store = store
+}
+
+func (p *Permissions) GetPermissionsFor(userId int64) *CameraPermissions {
+	return p.withGuest(p.getBase(userId), userId)
+}
+
+// getBase returns permissions from runtime or config layer without guest access
+func (p *Permissions) getBase(userId int64) *CameraPermissions {
+	permissions := CameraPermissions{}
+
+	ok, err := p.store.Get(bucketPermissions, strconv.FormatInt(userId, 10), &permissions)
+	if err != nil {
+		log.Println("Failed to get runtime permissions", userId, err)
+	}
+	if ok {
+		if len(permissions.Tags) == 0 {
+			return nil
+		}
+
+		return &permissions
+	}
+
+	for _, permissions := range p.config.Permissions {
+		if permissions.UserId == userId {
+			return &permissions
+		}
+	}
+
+	return nil
+}
+
+// All returns effective permissions of every known user
+func (p *Permissions) All() []CameraPermissions {
+	all := make([]CameraPermissions, 0)
+	runtime := make(map[int64]bool)
+
+	err := p.store.Scan(bucketPermissions, "", func(key string, raw json.RawMessage) bool {
+		permissions := CameraPermissions{}
+		if json.Unmarshal(raw, &permissions) == nil {
+			runtime[permissions.UserId] = true
+			if len(permissions.Tags) > 0 {
+				all = append(all, permissions)
+			}
+		}
+
+		return true
+	})
+	if err != nil {
+		log.Println("Failed to scan runtime permissions", err)
+	}
+
+	for _, permissions := range p.config.Permissions {
+		if !runtime[permissions.UserId] {
+			all = append(all, permissions)
+		}
+	}
+
+	for _, guest := range p.guests() {
+		index := slices.IndexFunc(all, func(permissions CameraPermissions) bool {
+			return permissions.UserId == guest.UserId
+		})
+
+		merged := p.withGuest(nil, guest.UserId)
+		if index != -1 {
+			merged = p.withGuest(&all[index], guest.UserId)
+		}
+		if merged == nil {
+			continue
+		}
+
+		if index != -1 {
+			all[index] = *merged
+		} else {
+			all = append(all, *merged)
+		}
+	}
+
+	return all
+}
+
+// GetUsersFor returns ids of users having capability on camera with the tag
+func (p *Permissions) GetUsersFor(tag string, capability Capability) []int64 {
+	users := make([]int64, 0)
+	for _, permissions := range p.All() {
+		if permissions.Can(tag, capability) {
+			users = append(users, permissions.UserId)
+		}
+	}
+
+	return users
+}
+
+// GetTimelapseSubscribersFor returns ids of users receiving daily timelapse of camera with the tag
+func (p *Permissions) GetTimelapseSubscribersFor(tag string) []int64 {
+	users := make([]int64, 0)
+	for _, permissions := range p.All() {
+		if permissions.Can(tag, CapSnapshot) && slices.Contains(permissions.Timelapse, tag) {
+			users = append(users, permissions.UserId)
+		}
+	}
+
+	return users
+}
+
+// Grant adds camera tags to user permissions
+func (p *Permissions) Grant(userId int64, tags []string) (CameraPermissions, error) {
+	err := p.validateTags(tags)
+	if err != nil {
+		return CameraPermissions{}, err
+	}
+
+	permissions := p.current(userId)
+	for _, tag := range tags {
+		if !slices.Contains(permissions.Tags, tag) {
+			permissions.Tags = append(permissions.Tags, tag)
+		}
+	}
+
+	return permissions, p.save(permissions)
+}
+
+// Revoke removes camera tags from user permissions and guest access, all of them when tags are empty
+func (p *Permissions) Revoke(userId int64, tags []string) (CameraPermissions, error) {
+	permissions := p.current(userId)
+
+	if len(tags) == 0 {
+		permissions.Tags = []string{}
+
+		err := p.removeGuest(userId)
+		if err != nil {
+			return permissions, err
+		}
+	} else {
+		permissions.Tags = slices.DeleteFunc(permissions.Tags, func(tag string) bool {
+			return slices.Contains(tags, tag)
+		})
+
+		err := p.revokeGuestTags(userId, tags)
+		if err != nil {
+			return permissions, err
+		}
+	}
+
+	err := p.save(permissions)
+	if err != nil {
+		return permissions, err
+	}
+
+	// result includes guest tags which are left
+	return *p.withGuest(&permissions, userId), nil
+}
+
+// SetRole assigns role to user, or to particular cameras of the user when tags are given
+func (p *Permissions) SetRole(userId int64, role string, tags []string) (CameraPermissions, error) {
+	err := validateRole(role)
+	if err != nil {
+		return CameraPermissions{}, err
+	}
+
+	err = p.validateTags(tags)
+	if err != nil {
+		return CameraPermissions{}, err
+	}
+
+	permissions := p.current(userId)
+	if len(tags) == 0 {
+		permissions.Role = role
+	} else {
+		cameraRoles := make(map[string]string, len(permissions.CameraRoles)+len(tags))
+		for tag, cameraRole := range permissions.CameraRoles {
+			cameraRoles[tag] = cameraRole
+		}
+		for _, tag := range tags {
+			cameraRoles[tag] = role
+		}
+		permissions.CameraRoles = cameraRoles
+	}
+
+	return permissions, p.save(permissions)
+}
+
+// SetUnlimited grants or clears exemption of the user from rate limits and recording quotas
+func (p *Permissions) SetUnlimited(userId int64, unlimited bool) (CameraPermissions, error) {
+	permissions := p.current(userId)
+	permissions.Unlimited = unlimited
+
+	return permissions, p.save(permissions)
+}
+
+func (p *Permissions) current(userId int64) CameraPermissions {
+	permissions := p.getBase(userId)
+	if permissions == nil {
+		return CameraPermissions{UserId: userId, Tags: []string{}}
+	}
+
+	current := *permissions
+	current.Tags = slices.Clone(permissions.Tags)
+
+	return current
+}
+
+func (p *Permissions) save(permissions CameraPermissions) error {
+	err := p.store.Put(bucketPermissions, strconv.FormatInt(permissions.UserId, 10), permissions, 0)
+	if err != nil {
+		return fmt.Errorf("failed to save permissions: %w", err)
+	}
+
+	return nil
+}
+
+func (p *Permissions) validateTags(tags []string) error {
+	for _, tag := range tags {
+		found := slices.ContainsFunc(p.config.Cameras, func(camera CameraConfig) bool {
+			return camera.Tag == tag
+		})
+		if !found {
+			return fmt.Errorf("unknown camera tag: %v", tag)
+		}
+	}
+
+	return nil
+}
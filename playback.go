@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// isapiTimeFormat is used by ISAPI search and playback, cameras treat it as their local time despite Z suffix
+const isapiTimeFormat = "2006-01-02T15:04:05Z"
+const isapiPlaybackTimeFormat = "20060102T150405Z"
+
+var ErrNoRecordings = errors.New("no recordings found")
+
+// Recording is a track segment stored on camera SD card or NVR disk
+type Recording struct {
+	PlaybackURI string
+	Start       time.Time
+	End         time.Time
+}
+
+// PlaybackDriver is implemented by drivers able to search and play stored recordings
+type PlaybackDriver interface {
+	SearchRecordings(client *http.Client, from, to time.Time) ([]Recording, error)
+	PlaybackURL(recording Recording, from, to time.Time) string
+}
+
+type isapiSearchResult struct {
+	Status  string `xml:"responseStatusStrg"`
+	Matches []struct {
+		Start       string `xml:"timeSpan>startTime"`
+		End         string `xml:"timeSpan>endTime"`
+		PlaybackURI string `xml:"mediaSegmentDescriptor>playbackURI"`
+	} `xml:"matchList>searchMatchItem"`
+}
+
+func (d *HikvisionDriver) trackID() string {
+	return fmt.Sprintf("%d01", d.conf.ChannelNumber())
+}
+
+func (d *HikvisionDriver) SearchRecordings(client *http.Client, from, to time.Time) ([]Recording, error) {
+	searchID := make([]byte, 16)
+	_, _ = rand.Read(searchID)
+
+	body := fmt.Sprintf(
+		`<?xml version="1.0" encoding="UTF-8"?><CMSearchDescription><searchID>%v</searchID><trackIDList><trackID>%v</trackID></trackIDList><timeSpanList><timeSpan><startTime>%v</startTime><endTime>%v</endTime></timeSpan></timeSpanList><maxResults>40</maxResults><searchResultPostion>0</searchResultPostion><metadataList><metadataDescriptor>//recordType.meta.std-cgi.com</metadataDescriptor></metadataList></CMSearchDescription>`,
+		hex.EncodeToString(searchID),
+		d.trackID(),
+		from.Format(isapiTimeFormat),
+		to.Format(isapiTimeFormat),
+	)
+
+	url := url.URL{
+		Scheme: "http",
+		Host:   d.conf.Host,
+		Path:   "ISAPI/ContentMgmt/search",
+	}
+
+	res, err := client.Post(url.String(), "application/xml", bytes.NewBufferString(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search recordings: %w", err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected search response status: %v", res.StatusCode)
+	}
+
+	result := isapiSearchResult{}
+	err = xml.Unmarshal(data, &result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse search response: %w", err)
+	}
+
+	recordings := make([]Recording, 0, len(result.Matches))
+	for _, match := range result.Matches {
+		start, err := time.ParseInLocation(isapiTimeFormat, match.Start, time.Local)
+		if err != nil {
+			continue
+		}
+
+		end, err := time.ParseInLocation(isapiTimeFormat, match.End, time.Local)
+		if err != nil {
+			continue
+		}
+
+		recordings = append(recordings, Recording{
+			PlaybackURI: match.PlaybackURI,
+			Start:       start,
+			End:         end,
+		})
+	}
+
+	return recordings, nil
+}
+
+// PlaybackURL narrows recording playback URI to the window and adds credentials
+func (d *HikvisionDriver) PlaybackURL(recording Recording, from, to time.Time) string {
+	u, err := url.Parse(recording.PlaybackURI)
+	if err != nil {
+		return recording.PlaybackURI
+	}
+
+	if from.Before(recording.Start) {
+		from = recording.Start
+	}
+	if to.After(recording.End) {
+		to = recording.End
+	}
+
+	query := u.Query()
+	query.Set("starttime", from.Format(isapiPlaybackTimeFormat))
+	query.Set("endtime", to.Format(isapiPlaybackTimeFormat))
+	query.Del("name")
+	query.Del("size")
+	u.RawQuery = query.Encode()
+
+	return withCredentials(u.String(), d.conf.User, d.conf.Pass)
+}
+
+// RecordPlayback finds stored recording covering the window and records it into filePath
+// SupportsPlayback reports whether camera driver can search stored recordings
+func (cs *Cameras) SupportsPlayback(tag string) bool {
+	driver, err := cs.Driver(tag)
+	if err != nil {
+		return false
+	}
+
+	_, ok := driver.(PlaybackDriver)
+
+	return ok
+}
+
+func (cs *Cameras) RecordPlayback(env Env, tag string, from, to time.Time, filePath string) error {
+	driver, err := cs.Driver(tag)
+	if err != nil {
+		return err
+	}
+
+	playbackDriver, ok := driver.(PlaybackDriver)
+	if !ok {
+		return fmt.Errorf("camera %v does not support playback", tag)
+	}
+
+	client, err := cs.Get(tag)
+	if err != nil {
+		return err
+	}
+
+	recordings, err := playbackDriver.SearchRecordings(client, from, to)
+	if err != nil {
+		return err
+	}
+
+	for _, recording := range recordings {
+		if recording.Start.Before(to) && recording.End.After(from) {
+			start := from
+			if recording.Start.After(from) {
+				start = recording.Start
+			}
+
+			return RecordClip(env, playbackDriver.PlaybackURL(recording, from, to), to.Sub(start), filePath)
+		}
+	}
+
+	return ErrNoRecordings
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	ptzSpeed        = 50
+	ptzMoveDuration = time.Millisecond * 500
+)
+
+type PtzPreset struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// PtzMove is a direction of continuous move in ISAPI terms
+type PtzMove struct {
+	Pan  int
+	Tilt int
+	Zoom int
+}
+
+var PtzMoves = map[string]PtzMove{
+	"up":    {Tilt: ptzSpeed},
+	"down":  {Tilt: -ptzSpeed},
+	"left":  {Pan: -ptzSpeed},
+	"right": {Pan: ptzSpeed},
+	"in":    {Zoom: ptzSpeed},
+	"out":   {Zoom: -ptzSpeed},
+}
+
+// PtzDriver is implemented by drivers able to control pan, tilt and zoom
+type PtzDriver interface {
+	ContinuousMove(client *http.Client, move PtzMove) error
+	GotoPreset(client *http.Client, preset int) error
+}
+
+func (d *HikvisionDriver) ptzURL(path string) string {
+	url := url.URL{
+		Scheme: "http",
+		Host:   d.conf.Host,
+		Path:   fmt.Sprintf("ISAPI/PTZCtrl/channels/%v/%v", d.conf.ChannelNumber(), path),
+	}
+
+	return url.String()
+}
+
+func (d *HikvisionDriver) ContinuousMove(client *http.Client, move PtzMove) error {
+	body := fmt.Sprintf(
+		`<?xml version="1.0" encoding="UTF-8"?><PTZData><pan>%v</pan><tilt>%v</tilt><zoom>%v</zoom></PTZData>`,
+		move.Pan,
+		move.Tilt,
+		move.Zoom,
+	)
+
+	return isapiPut(client, d.ptzURL("continuous"), body)
+}
+
+func (d *HikvisionDriver) GotoPreset(client *http.Client, preset int) error {
+	return isapiPut(client, d.ptzURL(fmt.Sprintf("presets/%v/goto", preset)), "")
+}
+
+func isapiPut(client *http.Client, url, body string) error {
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewBufferString(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/xml")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected ISAPI response status: %v", res.StatusCode)
+	}
+
+	return nil
+}
+
+// Move turns camera in direction for a short time and stops it
+func (cs *Cameras) Move(tag string, move PtzMove) error {
+	driver, client, err := cs.ptz(tag)
+	if err != nil {
+		return err
+	}
+
+	err = driver.ContinuousMove(client, move)
+	if err != nil {
+		return fmt.Errorf("failed to start ptz move: %w", err)
+	}
+
+	time.Sleep(ptzMoveDuration)
+
+	err = driver.ContinuousMove(client, PtzMove{})
+	if err != nil {
+		return fmt.Errorf("failed to stop ptz move: %w", err)
+	}
+
+	return nil
+}
+
+func (cs *Cameras) GotoPreset(tag string, preset int) error {
+	driver, client, err := cs.ptz(tag)
+	if err != nil {
+		return err
+	}
+
+	return driver.GotoPreset(client, preset)
+}
+
+func (cs *Cameras) ptz(tag string) (PtzDriver, *http.Client, error) {
+	driver, err := cs.Driver(tag)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ptzDriver, ok := driver.(PtzDriver)
+	if !ok {
+		return nil, nil, fmt.Errorf("camera %v does not support ptz", tag)
+	}
+
+	client, err := cs.Get(tag)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ptzDriver, client, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Capability is a single action user may perform on a camera
+type Capability string
+
+const (
+	CapSnapshot Capability = "snapshot"
+	CapRecord   Capability = "record"
+	CapCall     Capability = "call"
+	CapPtz      Capability = "ptz"
+	CapAlerts   Capability = "alerts"
+	CapAdmin    Capability = "admin"
+)
+
+const (
+	RoleViewer   = "viewer"
+	RoleUser     = "user"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// Roles maps role name to capabilities it grants,
+// users without role get RoleUser which matches access before roles were introduced
+var Roles = map[string][]Capability{
+	RoleViewer:   {CapSnapshot, CapAlerts},
+	RoleUser:     {CapSnapshot, CapRecord, CapCall, CapAlerts},
+	RoleOperator: {CapSnapshot, CapRecord, CapCall, CapAlerts, CapPtz},
+	RoleAdmin:    {CapSnapshot, CapRecord, CapCall, CapAlerts, CapPtz, CapAdmin},
+}
+
+func validateRole(role string) error {
+	if _, ok := Roles[role]; !ok {
+		return fmt.Errorf("unknown role: %v", role)
+	}
+
+	return nil
+}
+
+// RoleFor returns role of the user for camera with the tag
+func (p *CameraPermissions) RoleFor(tag string) string {
+	if role, ok := p.CameraRoles[tag]; ok {
+		return role
+	}
+
+	if p.Role == "" {
+		return RoleUser
+	}
+
+	return p.Role
+}
+
+// Can reports whether user may perform capability on camera with the tag right now
+func (p *CameraPermissions) Can(tag string, capability Capability) bool {
+	return p.has(tag, capability) && p.AllowedAt(tag, time.Now())
+}
+
+// has reports whether role grants capability on camera with the tag regardless of schedule
+func (p *CameraPermissions) has(tag string, capability Capability) bool {
+	if !slices.Contains(p.Tags, tag) {
+		return false
+	}
+
+	// legacy ptz list grants ptz on top of the role
+	if capability == CapPtz && slices.Contains(p.Ptz, tag) {
+		return true
+	}
+
+	return slices.Contains(Roles[p.RoleFor(tag)], capability)
+}
+
+func (p *CameraPermissions) IsAdmin() bool {
+	return slices.Contains(Roles[p.RoleFor("")], CapAdmin)
+}
+
+// Requirement is a declarative access rule attached to command or callback handler
+type Requirement struct {
+	Capability Capability
+	// Tag limits requirement to single camera, otherwise capability on any camera is enough.
+	// Callback requirements are bound to camera of the payload.
+	Tag string
+	// Bucket is name of rate limit bucket consumed by the handler, not limited when empty
+	Bucket string
+}
+
+func Requires(capability Capability) Requirement {
+	return Requirement{Capability: capability}
+}
+
+// On narrows requirement to camera with the tag
+func (r Requirement) On(tag string) Requirement {
+	r.Tag = tag
+	return r
+}
+
+// Check returns ErrNotAllowed when role lacks capability
+// and ErrOutsideSchedule when capability is granted but not at the moment
+func (r Requirement) Check(permissions *CameraPermissions, moment time.Time) error {
+	if r.Capability == "" {
+		return nil
+	}
+
+	if r.Capability == CapAdmin {
+		if permissions.IsAdmin() {
+			return nil
+		}
+
+		return ErrNotAllowed
+	}
+
+	tags := permissions.Tags
+	if r.Tag != "" {
+		tags = []string{r.Tag}
+	}
+
+	err := ErrNotAllowed
+	for _, tag := range tags {
+		if !permissions.has(tag, r.Capability) {
+			continue
+		}
+
+		if permissions.AllowedAt(tag, moment) {
+			return nil
+		}
+		err = ErrOutsideSchedule
+	}
+
+	return err
+}
+
+// Limited makes handler consume token of the rate limit bucket
+func (r Requirement) Limited(bucket string) Requirement {
+	r.Bucket = bucket
+	return r
+}
+
+func (r Requirement) String() string {
+	if r.Tag != "" {
+		return fmt.Sprintf("%v on %v", r.Capability, r.Tag)
+	}
+
+	return string(r.Capability)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const scheduleTimeFormat = "15:04"
+
+var (
+	ErrNotAllowed      = errors.New("not allowed")
+	ErrOutsideSchedule = errors.New("access outside of allowed hours")
+)
+
+var scheduleDays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ScheduleRule is a time window when user may access cameras,
+// e.g. {"tags": ["hallway"], "days": ["mon", "tue", "wed", "thu", "fri"], "from": "09:00", "to": "17:00"}
+type ScheduleRule struct {
+	// Tags limits rule to cameras, rule applies to all cameras of the user when empty
+	Tags []string `json:"tags,omitempty"`
+	// Days are short week day names, every day when empty
+	Days []string `json:"days,omitempty"`
+	// From and To are HH:MM, window wraps over midnight when To is before From
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Timezone is IANA name, bot local time is used when empty
+	Timezone string `json:"timezone,omitempty"`
+}
+
+func (r ScheduleRule) String() string {
+	days := "every day"
+	if len(r.Days) > 0 {
+		days = strings.Join(r.Days, ",")
+	}
+
+	tz := ""
+	if r.Timezone != "" {
+		tz = " " + r.Timezone
+	}
+
+	tags := ""
+	if len(r.Tags) > 0 {
+		tags = fmt.Sprintf("%v: ", r.Tags)
+	}
+
+	return fmt.Sprintf("%v%v %v-%v%v", tags, days, r.From, r.To, tz)
+}
+
+func (r ScheduleRule) Validate() error {
+	for _, day := range r.Days {
+		if _, ok := scheduleDays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("unknown week day: %v", day)
+		}
+	}
+
+	for _, value := range []string{r.From, r.To} {
+		_, err := time.Parse(scheduleTimeFormat, value)
+		if err != nil {
+			return fmt.Errorf("invalid time %v: %w", value, err)
+		}
+	}
+
+	_, err := r.location(time.Local)
+	if err != nil {
+		return fmt.Errorf("invalid timezone %v: %w", r.Timezone, err)
+	}
+
+	return nil
+}
+
+// location returns rule timezone, empty one is local rather than UTC of time.LoadLocation
+func (r ScheduleRule) location(local *time.Location) (*time.Location, error) {
+	if r.Timezone == "" {
+		return local, nil
+	}
+
+	return time.LoadLocation(r.Timezone)
+}
+
+func (r ScheduleRule) appliesTo(tag string) bool {
+	return len(r.Tags) == 0 || slices.Contains(r.Tags, tag)
+}
+
+// Contains reports whether moment falls into the rule window, invalid rules contain nothing
+func (r ScheduleRule) Contains(moment time.Time) bool {
+	return r.containsIn(moment, time.Local)
+}
+
+// containsIn checks rule window using local as timezone of rule without one
+func (r ScheduleRule) containsIn(moment time.Time, local *time.Location) bool {
+	location, err := r.location(local)
+	if err != nil {
+		return false
+	}
+	moment = moment.In(location)
+
+	from, errFrom := time.Parse(scheduleTimeFormat, r.From)
+	to, errTo := time.Parse(scheduleTimeFormat, r.To)
+	if errFrom != nil || errTo != nil {
+		return false
+	}
+
+	minute := moment.Hour()*60 + moment.Minute()
+	start := from.Hour()*60 + from.Minute()
+	end := to.Hour()*60 + to.Minute()
+
+	// after midnight part of wrapping window belongs to previous day
+	day := moment.Weekday()
+	inWindow := minute >= start && minute < end
+	if end <= start {
+		inWindow = minute >= start || minute < end
+		if minute < end {
+			day = (day + 6) % 7
+		}
+	}
+
+	return inWindow && r.onDay(day)
+}
+
+func (r ScheduleRule) onDay(day time.Weekday) bool {
+	if len(r.Days) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(r.Days, func(name string) bool {
+		return scheduleDays[strings.ToLower(name)] == day
+	})
+}
+
+// AllowedAt reports whether schedule of the user permits camera with the tag at moment,
+// cameras without applicable rules are always allowed
+func (p *CameraPermissions) AllowedAt(tag string, moment time.Time) bool {
+	applicable := false
+	for _, rule := range p.Schedule {
+		if !rule.appliesTo(tag) {
+			continue
+		}
+
+		if rule.Contains(moment) {
+			return true
+		}
+		applicable = true
+	}
+
+	return !applicable
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleRuleContains(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("timezone database is not available:", err)
+	}
+
+	workdays := ScheduleRule{Days: []string{"mon", "tue", "wed", "thu", "fri"}, From: "09:00", To: "17:00", Timezone: "Europe/Berlin"}
+	nights := ScheduleRule{Days: []string{"fri"}, From: "22:00", To: "06:00", Timezone: "Europe/Berlin"}
+
+	// 2024-06-03 is Monday
+	tests := []struct {
+		name   string
+		rule   ScheduleRule
+		moment time.Time
+		want   bool
+	}{
+		{"weekday window start", workdays, time.Date(2024, 6, 3, 9, 0, 0, 0, berlin), true},
+		{"weekday window middle", workdays, time.Date(2024, 6, 7, 13, 30, 0, 0, berlin), true},
+		{"weekday window end is excluded", workdays, time.Date(2024, 6, 3, 17, 0, 0, 0, berlin), false},
+		{"weekday before window", workdays, time.Date(2024, 6, 3, 8, 59, 0, 0, berlin), false},
+		{"weekend", workdays, time.Date(2024, 6, 8, 13, 0, 0, 0, berlin), false},
+		{"other timezone is converted", workdays, time.Date(2024, 6, 3, 7, 30, 0, 0, time.UTC), true},
+		{"wrapping window before midnight", nights, time.Date(2024, 6, 7, 23, 0, 0, 0, berlin), true},
+		{"wrapping window after midnight belongs to previous day", nights, time.Date(2024, 6, 8, 5, 59, 0, 0, berlin), true},
+		{"wrapping window end is excluded", nights, time.Date(2024, 6, 8, 6, 0, 0, 0, berlin), false},
+		{"wrapping window after midnight of other day", nights, time.Date(2024, 6, 7, 3, 0, 0, 0, berlin), false},
+		{"wrapping window before midnight of other day", nights, time.Date(2024, 6, 8, 23, 0, 0, 0, berlin), false},
+		{"wrapping window outside", nights, time.Date(2024, 6, 7, 12, 0, 0, 0, berlin), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Contains(tt.moment); got != tt.want {
+				t.Errorf("Contains(%v) = %v, want %v", tt.moment, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleRuleLocalTime(t *testing.T) {
+	local := time.FixedZone("UTC+5", 5*60*60)
+
+	rule := ScheduleRule{From: "09:00", To: "17:00"}
+	if err := rule.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 10:00 local is 05:00 UTC
+	if !rule.containsIn(time.Date(2024, 6, 3, 10, 0, 0, 0, local), local) {
+		t.Error("rule without timezone is not checked in local time")
+	}
+
+	// 14:00 UTC is 19:00 local
+	if rule.containsIn(time.Date(2024, 6, 3, 14, 0, 0, 0, time.UTC), local) {
+		t.Error("rule without timezone is checked in UTC")
+	}
+}
+
+func TestScheduleRuleValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  ScheduleRule
+		valid bool
+	}{
+		{"valid", ScheduleRule{Days: []string{"Mon"}, From: "09:00", To: "17:00"}, true},
+		{"unknown day", ScheduleRule{Days: []string{"monday"}, From: "09:00", To: "17:00"}, false},
+		{"invalid time", ScheduleRule{From: "9", To: "17:00"}, false},
+		{"invalid timezone", ScheduleRule{From: "09:00", To: "17:00", Timezone: "Mars/Olympus"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); (err == nil) != tt.valid {
+				t.Errorf("Validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
@@ -1,62 +1,119 @@
 package main
 
 import (
-	"sync"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// A basic handler State to share state across executions.
-// Note: This is a very simple layout which uses a shared mutex.
-// It is all in-memory, and so will not persist data across restarts.
+const (
+	// sessionTTL is how long pending selections (e.g. chosen camera) are kept
+	sessionTTL = time.Hour
+	historyTTL = time.Hour * 24 * 30
+
+	SubscriptionTimelapse = "timelapse"
+)
+
+type HistoryEntry struct {
+	Action string    `json:"action"`
+	Time   time.Time `json:"time"`
+}
+
+// A handler State to share state across executions.
+// It is backed by persistent Store so pending selections, subscriptions
+// and history survive restarts.
 type State struct {
-	// Use a mutex to avoid concurrency issues.
-	// If you use multiple maps, you may want to use a new mutex for each one.
-	rwMux sync.RWMutex
-
-	// We use a double map to:
-	// - map once for the user id
-	// - map a second time for the keys a user can have
-	// The second map has values of type "any" so anything can be stored in them, for the purpose of this example.
-	// This could be improved by using a struct with typed fields, though this would need some additional handling to
-	// ensure concurrent safety.
-	userData map[int64]map[string]any
-
-	// This struct could also contain:
-	// - pointers to database connections
-	// - pointers cache connections
-	// - localised strings
-	// - helper methods for retrieving/caching chat settings
-}
-
-func (c *State) Setup() {
-	if c.userData == nil {
-		c.userData = map[int64]map[string]any{}
-	}
+	store Store
+}
+
+func (c *State) Setup(store Store) {
+	c.store = store
 }
 
-func (c *State) Get(userId int64, key string) (any, bool) {
-	c.rwMux.RLock()
-	defer c.rwMux.RUnlock()
+// Get returns transient session value of the user
+func (c *State) Get(userId int64, key string) (string, bool) {
+	var value string
 
-	if c.userData == nil {
-		return nil, false
+	ok, err := c.store.Get(bucketSessions, sessionKey(userId, key), &value)
+	if err != nil {
+		log.Println("Failed to get session value", userId, key, err)
+		return "", false
 	}
 
-	userData, ok := c.userData[userId]
-	if !ok {
-		return nil, false
+	return value, ok
+}
+
+// Set stores transient session value of the user which expires after sessionTTL
+func (c *State) Set(userId int64, key string, val string) error {
+	err := c.store.Put(bucketSessions, sessionKey(userId, key), val, sessionTTL)
+	if err != nil {
+		return fmt.Errorf("failed to set session value: %w", err)
 	}
 
-	v, ok := userData[key]
-	return v, ok
+	return nil
+}
+
+func (c *State) Subscribe(userId int64, kind, tag string) error {
+	return c.store.Put(bucketSubscriptions, subscriptionKey(kind, tag, userId), true, 0)
 }
 
-func (c *State) Set(userId int64, key string, val any) {
-	c.rwMux.Lock()
-	defer c.rwMux.Unlock()
+func (c *State) Unsubscribe(userId int64, kind, tag string) error {
+	return c.store.Delete(bucketSubscriptions, subscriptionKey(kind, tag, userId))
+}
+
+// Subscribers returns ids of users subscribed to kind of updates of camera with the tag
+func (c *State) Subscribers(kind, tag string) []int64 {
+	users := make([]int64, 0)
+	prefix := fmt.Sprintf("%v/%v/", kind, tag)
+
+	err := c.store.Scan(bucketSubscriptions, prefix, func(key string, raw json.RawMessage) bool {
+		userId, err := strconv.ParseInt(strings.TrimPrefix(key, prefix), 10, 64)
+		if err == nil {
+			users = append(users, userId)
+		}
 
-	_, ok := c.userData[userId]
-	if !ok {
-		c.userData[userId] = map[string]any{}
+		return true
+	})
+	if err != nil {
+		log.Println("Failed to scan subscriptions", kind, tag, err)
 	}
-	c.userData[userId][key] = val
+
+	return users
+}
+
+func (c *State) AddHistory(userId int64, action string) error {
+	now := time.Now()
+	key := fmt.Sprintf("%v/%020d", userId, now.UnixNano())
+
+	return c.store.Put(bucketHistory, key, HistoryEntry{action, now}, historyTTL)
+}
+
+// History returns up to limit latest history entries of the user in chronological order
+func (c *State) History(userId int64, limit int) []HistoryEntry {
+	entries := make([]HistoryEntry, 0)
+
+	err := c.store.Scan(bucketHistory, fmt.Sprintf("%v/", userId), func(key string, raw json.RawMessage) bool {
+		entry := HistoryEntry{}
+		if json.Unmarshal(raw, &entry) == nil {
+			entries = append(entries, entry)
+		}
+
+		return true
+	})
+	if err != nil {
+		log.Println("Failed to scan history", userId, err)
+	}
+
+	return entries[max(0, len(entries)-limit):]
+}
+
+func sessionKey(userId int64, key string) string {
+	return fmt.Sprintf("%v/%v", userId, key)
+}
+
+func subscriptionKey(kind, tag string, userId int64) string {
+	return fmt.Sprintf("%v/%v/%v", kind, tag, userId)
 }
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	bucketMeta          = "meta"
+	bucketSessions      = "sessions"
+	bucketSubscriptions = "subscriptions"
+	bucketHistory       = "history"
+	bucketPermissions   = "permissions"
+	bucketInvites       = "invites"
+	bucketGuests        = "guests"
+	bucketAudit         = "audit"
+	bucketQuotas        = "quotas"
+
+	storeSweepInterval = time.Minute
+)
+
+// unsweptBuckets never contain records with TTL, append-only audit is pruned by retention instead
+var unsweptBuckets = []string{bucketMeta, bucketAudit}
+
+// StoreTx reads and writes buckets within single transaction
+type StoreTx interface {
+	Get(bucket, key string, value any) (bool, error)
+	Put(bucket, key string, value any, ttl time.Duration) error
+	Delete(bucket, key string) error
+}
+
+// Store is a persistent key-value storage split into buckets.
+// Values are JSON encoded, keys with TTL are removed after expiration.
+type Store interface {
+	StoreTx
+	// Update runs fn in single write transaction, nothing is saved when fn returns error
+	Update(fn func(tx StoreTx) error) error
+	// Scan walks over keys with prefix in key order, returning false from fn stops the walk
+	Scan(bucket, prefix string, fn func(key string, raw json.RawMessage) bool) error
+	// ScanFrom walks over keys starting from the key in key order, returning false from fn stops the walk
+	ScanFrom(bucket, from string, fn func(key string, raw json.RawMessage) bool) error
+	// Prune removes keys ordered before the key, used for append-only buckets with time ordered keys
+	Prune(bucket, before string) (int, error)
+	Close() error
+}
+
+type storeRecord struct {
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt int64           `json:"expires_at,omitempty"`
+}
+
+func (r storeRecord) expired(now time.Time) bool {
+	return r.ExpiresAt != 0 && r.ExpiresAt <= now.UnixNano()
+}
+
+// migration upgrades store schema, migrations are applied in order and never edited once released
+type migration func(tx *bolt.Tx) error
+
+var migrations = []migration{
+	// 1: initial buckets
+	func(tx *bolt.Tx) error {
+		for _, bucket := range []string{bucketSessions, bucketSubscriptions, bucketHistory} {
+			_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+	// 2: runtime permissions layered over config file
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucketPermissions))
+		return err
+	},
+	// 3: guest invites and expiring guest access
+	func(tx *bolt.Tx) error {
+		for _, bucket := range []string{bucketInvites, bucketGuests} {
+			_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+	// 4: append-only audit log
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucketAudit))
+		return err
+	},
+	// 5: daily recording quotas
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucketQuotas))
+		return err
+	},
+}
+
+type BoltStore struct {
+	db   *bolt.DB
+	done chan struct{}
+}
+
+func OpenBoltStore(filePath string) (*BoltStore, error) {
+	db, err := bolt.Open(filePath, 0o600, &bolt.Options{Timeout: time.Second * 5})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store: %w", err)
+	}
+
+	store := &BoltStore{db, make(chan struct{})}
+
+	err = store.migrate()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	go store.sweep()
+
+	return store, nil
+}
+
+func (s *BoltStore) migrate() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists([]byte(bucketMeta))
+		if err != nil {
+			return err
+		}
+
+		version := 0
+		if raw := meta.Get([]byte("version")); raw != nil {
+			version = int(binary.BigEndian.Uint64(raw))
+		}
+
+		for ; version < len(migrations); version++ {
+			log.Println("Applying store migration", version+1)
+
+			err := migrations[version](tx)
+			if err != nil {
+				return fmt.Errorf("failed to apply store migration %v: %w", version+1, err)
+			}
+		}
+
+		raw := make([]byte, 8)
+		binary.BigEndian.PutUint64(raw, uint64(version))
+
+		return meta.Put([]byte("version"), raw)
+	})
+}
+
+func (s *BoltStore) Get(bucket, key string, value any) (bool, error) {
+	found := false
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		found, err = boltTx{tx}.Get(bucket, key, value)
+		return err
+	})
+
+	return found, err
+}
+
+func (s *BoltStore) Put(bucket, key string, value any, ttl time.Duration) error {
+	return s.Update(func(tx StoreTx) error {
+		return tx.Put(bucket, key, value, ttl)
+	})
+}
+
+func (s *BoltStore) Delete(bucket, key string) error {
+	return s.Update(func(tx StoreTx) error {
+		return tx.Delete(bucket, key)
+	})
+}
+
+func (s *BoltStore) Update(fn func(tx StoreTx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+func (t boltTx) bucket(name string) (*bolt.Bucket, error) {
+	b := t.tx.Bucket([]byte(name))
+	if b == nil {
+		return nil, fmt.Errorf("unknown bucket: %v", name)
+	}
+
+	return b, nil
+}
+
+func (t boltTx) Get(bucket, key string, value any) (bool, error) {
+	b, err := t.bucket(bucket)
+	if err != nil {
+		return false, err
+	}
+
+	raw := b.Get([]byte(key))
+	if raw == nil {
+		return false, nil
+	}
+
+	record := storeRecord{}
+	err = json.Unmarshal(raw, &record)
+	if err != nil {
+		return false, err
+	}
+
+	if record.expired(time.Now()) {
+		return false, nil
+	}
+
+	return true, json.Unmarshal(record.Value, value)
+}
+
+func (t boltTx) Put(bucket, key string, value any, ttl time.Duration) error {
+	b, err := t.bucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	record := storeRecord{Value: encoded}
+	if ttl > 0 {
+		record.ExpiresAt = time.Now().Add(ttl).UnixNano()
+	}
+
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return b.Put([]byte(key), raw)
+}
+
+func (t boltTx) Delete(bucket, key string) error {
+	b, err := t.bucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	return b.Delete([]byte(key))
+}
+
+func (s *BoltStore) Scan(bucket, prefix string, fn func(key string, raw json.RawMessage) bool) error {
+	return s.scan(bucket, prefix, func(key string) bool { return strings.HasPrefix(key, prefix) }, fn)
+}
+
+func (s *BoltStore) ScanFrom(bucket, from string, fn func(key string, raw json.RawMessage) bool) error {
+	return s.scan(bucket, from, func(string) bool { return true }, fn)
+}
+
+func (s *BoltStore) scan(bucket, seek string, within func(key string) bool, fn func(key string, raw json.RawMessage) bool) error {
+	now := time.Now()
+
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return fmt.Errorf("unknown bucket: %v", bucket)
+		}
+
+		cursor := b.Cursor()
+		for k, v := cursor.Seek([]byte(seek)); k != nil && within(string(k)); k, v = cursor.Next() {
+			record := storeRecord{}
+			err := json.Unmarshal(v, &record)
+			if err != nil {
+				return err
+			}
+
+			if record.expired(now) {
+				continue
+			}
+
+			if !fn(string(k), record.Value) {
+				return nil
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *BoltStore) Prune(bucket, before string) (int, error) {
+	pruned := 0
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return fmt.Errorf("unknown bucket: %v", bucket)
+		}
+
+		cursor := b.Cursor()
+		for k, _ := cursor.First(); k != nil && string(k) < before; k, _ = cursor.First() {
+			err := cursor.Delete()
+			if err != nil {
+				return err
+			}
+			pruned++
+		}
+
+		return nil
+	})
+
+	return pruned, err
+}
+
+// Close stops sweeping and closes database, store must not be used afterwards
+func (s *BoltStore) Close() error {
+	close(s.done)
+
+	return s.db.Close()
+}
+
+// sweep periodically removes expired records, expired keys are collected
+// in read transaction so writers are blocked only when there is something to delete
+func (s *BoltStore) sweep() {
+	ticker := time.NewTicker(storeSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		err := s.removeExpired(time.Now())
+		if err != nil {
+			log.Println("Failed to sweep expired store records", err)
+		}
+	}
+}
+
+func (s *BoltStore) removeExpired(now time.Time) error {
+	expired := make(map[string][][]byte)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			if slices.Contains(unsweptBuckets, string(name)) {
+				return nil
+			}
+
+			return b.ForEach(func(k, v []byte) error {
+				record := storeRecord{}
+				if json.Unmarshal(v, &record) == nil && record.expired(now) {
+					expired[string(name)] = append(expired[string(name)], slices.Clone(k))
+				}
+
+				return nil
+			})
+		})
+	})
+	if err != nil || len(expired) == 0 {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for name, keys := range expired {
+			b := tx.Bucket([]byte(name))
+			if b == nil {
+				continue
+			}
+
+			for _, k := range keys {
+				// record could be refreshed since it was collected
+				record := storeRecord{}
+				raw := b.Get(k)
+				if raw == nil || json.Unmarshal(raw, &record) != nil || !record.expired(now) {
+					continue
+				}
+
+				err := b.Delete(k)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestStore(t *testing.T, filePath string) *BoltStore {
+	t.Helper()
+
+	store, err := OpenBoltStore(filePath)
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+
+	return store
+}
+
+func TestBoltStoreMigrations(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "state.db")
+
+	// reopening must not apply migrations again
+	for range 2 {
+		store := openTestStore(t, filePath)
+
+		err := store.db.View(func(tx *bolt.Tx) error {
+			version := binary.BigEndian.Uint64(tx.Bucket([]byte(bucketMeta)).Get([]byte("version")))
+			if int(version) != len(migrations) {
+				t.Errorf("store version = %v, want %v", version, len(migrations))
+			}
+
+			for _, bucket := range []string{bucketSessions, bucketSubscriptions, bucketHistory, bucketPermissions, bucketInvites, bucketGuests, bucketAudit, bucketQuotas} {
+				if tx.Bucket([]byte(bucket)) == nil {
+					t.Errorf("bucket %v is missing", bucket)
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = store.Close()
+		if err != nil {
+			t.Fatalf("failed to close store: %v", err)
+		}
+	}
+}
+
+func TestBoltStoreTTL(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "state.db"))
+	defer store.Close()
+
+	err := store.Put(bucketSessions, "1/expiring", "value", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Put(bucketSessions, "1/kept", "value", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond * 5)
+
+	var value string
+	found, err := store.Get(bucketSessions, "1/expiring", &value)
+	if err != nil || found {
+		t.Errorf("Get expired = %v, %v, want not found", found, err)
+	}
+
+	found, err = store.Get(bucketSessions, "1/kept", &value)
+	if err != nil || !found || value != "value" {
+		t.Errorf("Get kept = %q, %v, %v, want value", value, found, err)
+	}
+
+	keys := make([]string, 0)
+	err = store.Scan(bucketSessions, "1/", func(key string, raw json.RawMessage) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil || len(keys) != 1 || keys[0] != "1/kept" {
+		t.Errorf("Scan = %v, %v, want [1/kept]", keys, err)
+	}
+}
+
+func TestBoltStoreUnknownBucket(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "state.db"))
+	defer store.Close()
+
+	err := store.Put("unknown", "key", "value", 0)
+	if err == nil {
+		t.Error("Put into unknown bucket succeeded")
+	}
+}
+
+func TestStateSessions(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "state.db"))
+	defer store.Close()
+
+	state := State{}
+	state.Setup(store)
+
+	if _, ok := state.Get(1, "camera"); ok {
+		t.Error("Get of missing session value succeeded")
+	}
+
+	err := state.Set(1, "camera", "yard")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value, ok := state.Get(1, "camera"); !ok || value != "yard" {
+		t.Errorf("Get = %q, %v, want yard", value, ok)
+	}
+
+	if _, ok := state.Get(2, "camera"); ok {
+		t.Error("session value leaked to another user")
+	}
+
+	err = state.Subscribe(1, SubscriptionTimelapse, "yard")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = state.Subscribe(2, SubscriptionTimelapse, "yard")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = state.Unsubscribe(2, SubscriptionTimelapse, "yard")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if users := state.Subscribers(SubscriptionTimelapse, "yard"); len(users) != 1 || users[0] != 1 {
+		t.Errorf("Subscribers = %v, want [1]", users)
+	}
+
+	for _, action := range []string{"/all", "/record", "/ptz"} {
+		err := state.AddHistory(1, action)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history := state.History(1, 2)
+	if len(history) != 2 || history[0].Action != "/record" || history[1].Action != "/ptz" {
+		t.Errorf("History = %v, want /record and /ptz", history)
+	}
+}
+
+func TestBoltStoreScanFromAndPrune(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "state.db"))
+	defer store.Close()
+
+	for _, key := range []string{"001", "002", "003", "004"} {
+		err := store.Put(bucketAudit, key, key, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys := make([]string, 0)
+	err := store.ScanFrom(bucketAudit, "002", func(key string, raw json.RawMessage) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil || len(keys) != 3 || keys[0] != "002" {
+		t.Errorf("ScanFrom = %v, %v, want [002 003 004]", keys, err)
+	}
+
+	pruned, err := store.Prune(bucketAudit, "003")
+	if err != nil || pruned != 2 {
+		t.Errorf("Prune = %v, %v, want 2", pruned, err)
+	}
+
+	keys = keys[:0]
+	err = store.ScanFrom(bucketAudit, "", func(key string, raw json.RawMessage) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil || len(keys) != 2 || keys[0] != "003" {
+		t.Errorf("ScanFrom after prune = %v, %v, want [003 004]", keys, err)
+	}
+}
+
+func TestBoltStoreRemoveExpired(t *testing.T) {
+	store := openTestStore(t, filepath.Join(t.TempDir(), "state.db"))
+	defer store.Close()
+
+	err := store.Put(bucketSessions, "1/expiring", "value", time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Put(bucketSessions, "1/kept", "value", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.removeExpired(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucketSessions))
+		if b.Get([]byte("1/expiring")) != nil {
+			t.Error("expired record is not removed")
+		}
+		if b.Get([]byte("1/kept")) == nil {
+			t.Error("live record is removed")
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	timelapseFrameFormat = "20060102150405"
+	timelapseFps         = 24
+
+	defaultTimelapseInterval = 60
+	defaultTimelapseDays     = 2
+	defaultTimelapseHour     = 8
+)
+
+type TimelapseConfig struct {
+	Enabled bool `json:"enabled"`
+	// Interval between collected snapshots in seconds
+	Interval int `json:"interval"`
+	// Days is amount of days snapshots are kept
+	Days int `json:"days"`
+}
+
+func (t TimelapseConfig) IntervalDuration() time.Duration {
+	if t.Interval == 0 {
+		return defaultTimelapseInterval * time.Second
+	}
+
+	return time.Duration(t.Interval) * time.Second
+}
+
+func (t TimelapseConfig) Retention() time.Duration {
+	days := t.Days
+	if days == 0 {
+		days = defaultTimelapseDays
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// Timelapses collects periodic snapshots of cameras and renders them into videos
+type Timelapses struct {
+	app  *Application
+	dirs map[string]string
+}
+
+func (tl *Timelapses) Setup(app *Application) error {
+	tl.app = app
+	tl.dirs = make(map[string]string)
+
+	for _, conf := range app.config.Cameras {
+		if !conf.Timelapse.Enabled {
+			continue
+		}
+
+		dir, err := app.config.GetTimelapsePath(conf.Tag)
+		if err != nil {
+			return err
+		}
+
+		err = os.MkdirAll(dir, 0o755)
+		if err != nil {
+			return fmt.Errorf("failed to create timelapse dir for camera with tag %v: %w", conf.Tag, err)
+		}
+
+		tl.dirs[conf.Tag] = dir
+	}
+
+	return nil
+}
+
+func (tl *Timelapses) Start() {
+	for _, conf := range tl.app.config.Cameras {
+		if _, ok := tl.dirs[conf.Tag]; ok {
+			go tl.collect(conf)
+		}
+	}
+
+	if len(tl.dirs) > 0 {
+		go tl.schedule()
+	}
+}
+
+func (tl *Timelapses) Has(tag string) bool {
+	_, ok := tl.dirs[tag]
+	return ok
+}
+
+func (tl *Timelapses) collect(conf CameraConfig) {
+	dir := tl.dirs[conf.Tag]
+
+	ticker := time.NewTicker(conf.Timelapse.IntervalDuration())
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		image, err := tl.app.cameras.GetImage(conf.Tag, StreamMain)
+		if err != nil {
+			log.Println("Failed to get timelapse frame", conf.Tag, err)
+			continue
+		}
+
+		err = os.WriteFile(path.Join(dir, now.Format(timelapseFrameFormat)+".jpeg"), image, 0o644)
+		if err != nil {
+			log.Println("Failed to save timelapse frame", conf.Tag, err)
+			continue
+		}
+
+		tl.cleanup(conf)
+	}
+}
+
+func (tl *Timelapses) cleanup(conf CameraConfig) {
+	frames, err := tl.frames(conf.Tag, time.Time{}, time.Now().Add(-conf.Timelapse.Retention()))
+	if err != nil {
+		log.Println("Failed to list timelapse frames", conf.Tag, err)
+		return
+	}
+
+	for _, frame := range frames {
+		os.Remove(frame)
+	}
+}
+
+// frames returns sorted frame paths taken within [from, to)
+func (tl *Timelapses) frames(tag string, from, to time.Time) ([]string, error) {
+	dir, ok := tl.dirs[tag]
+	if !ok {
+		return nil, fmt.Errorf("timelapse is not enabled for %v camera", tag)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := make([]string, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		taken, err := time.ParseInLocation(timelapseFrameFormat, strings.TrimSuffix(name, filepath.Ext(name)), time.Local)
+		if err != nil {
+			continue
+		}
+
+		if !taken.Before(from) && taken.Before(to) {
+			frames = append(frames, path.Join(dir, name))
+		}
+	}
+
+	slices.Sort(frames)
+
+	return frames, nil
+}
+
+// Render builds MP4 from frames taken within [from, to)
+func (tl *Timelapses) Render(tag string, from, to time.Time, filePath string) error {
+	frames, err := tl.frames(tag, from, to)
+	if err != nil {
+		return err
+	}
+
+	if len(frames) == 0 {
+		return fmt.Errorf("no timelapse frames for %v camera", tag)
+	}
+
+	listPath := filePath + ".txt"
+	list := strings.Builder{}
+	for _, frame := range frames {
+		list.WriteString(fmt.Sprintf("file '%v'\nduration %.4f\n", frame, 1.0/timelapseFps))
+	}
+
+	err = os.WriteFile(listPath, []byte(list.String()), 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to write frames list: %w", err)
+	}
+	defer os.Remove(listPath)
+
+	// @EXAMPLE: ffmpeg -f concat -safe 0 -i frames.txt -r 24 -c:v libx264 -pix_fmt yuv420p timelapse.mp4
+	cmd := exec.Command(
+		"ffmpeg",
+		"-y",
+		"-loglevel", "error",
+		"-f", "concat",
+		"-safe", "0",
+		"-i", listPath,
+		"-r", fmt.Sprintf("%v", timelapseFps),
+		"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+		"-c:v", "libx264",
+		"-pix_fmt", "yuv420p",
+		"-movflags", "+faststart",
+		filePath,
+	)
+
+	fmt.Println("Prepared command", cmd)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to render timelapse: %w: %v", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// schedule delivers yesterday timelapse to subscribed users every morning
+func (tl *Timelapses) schedule() {
+	for {
+		now := time.Now()
+		next := time.Date(now.Year(), now.Month(), now.Day(), tl.app.config.TimelapseHourOfDay(), 0, 0, 0, time.Local)
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+
+		time.Sleep(time.Until(next))
+
+		today := time.Date(next.Year(), next.Month(), next.Day(), 0, 0, 0, 0, time.Local)
+		yesterday := today.AddDate(0, 0, -1)
+
+		for tag := range tl.dirs {
+			tl.deliver(tag, yesterday, today)
+		}
+	}
+}
+
+func (tl *Timelapses) deliver(tag string, from, to time.Time) {
+	users := tl.app.permissions.GetTimelapseSubscribersFor(tag)
+	for _, userId := range tl.app.state.Subscribers(SubscriptionTimelapse, tag) {
+		permissions := tl.app.permissions.GetPermissionsFor(userId)
+		if permissions != nil && permissions.Can(tag, CapSnapshot) && !slices.Contains(users, userId) {
+			users = append(users, userId)
+		}
+	}
+	if len(users) == 0 {
+		return
+	}
+
+	filePath, err := tl.app.config.GetTmpClipPath(fmt.Sprintf("timelapse_%v_%v", tag, from.Unix()))
+	if err != nil {
+		log.Println("Failed to prepare timelapse path", err)
+		return
+	}
+	defer os.Remove(filePath)
+
+	err = tl.Render(tag, from, to, filePath)
+	if err != nil {
+		log.Println("Failed to render daily timelapse", tag, err)
+		return
+	}
+
+	for _, userId := range users {
+		err := SendVideoFile(tl.app.tgBot, userId, filePath, fmt.Sprintf("%v timelapse of %v", tag, from.Format(time.DateOnly)))
+		if err != nil {
+			log.Println("Failed to send daily timelapse", userId, err)
+		}
+	}
+}